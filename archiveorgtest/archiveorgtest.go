@@ -0,0 +1,463 @@
+// Package archiveorgtest provides a fake Wayback Machine for testing code
+// which uses jaytaylor.com/archive.org without network access.
+//
+// The fake serves the sparkline and calendarcaptures endpoints used by Search,
+// TimeMaps, the availability and CDX APIs, replay of archived content and
+// both Save Page Now flavors from in-memory fixtures.  Failures such as rate
+// limiting, exclusions, server errors and slow responses are injected per
+// endpoint with Inject.
+package archiveorgtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"jaytaylor.com/archive.org"
+	"jaytaylor.com/archive.org/server"
+)
+
+const (
+	timestampLayout = "20060102150405"
+	warcFilename    = "fixtures.warc"
+)
+
+// Endpoint identifies a group of fake Wayback Machine endpoints for fault
+// injection and request counting.
+type Endpoint string
+
+const (
+	Sparkline        Endpoint = "sparkline"        // /__wb/sparkline
+	CalendarCaptures Endpoint = "calendarcaptures" // /__wb/calendarcaptures
+	TimeMap          Endpoint = "timemap"          // /web/timemap/
+	Available        Endpoint = "available"        // /wayback/available
+	CDX              Endpoint = "cdx"              // /cdx/search/cdx
+	Replay           Endpoint = "replay"           // /web/<timestamp>/<url> and the /web/<url> TimeGate
+	Save             Endpoint = "save"             // Legacy /save/<url> and Save Page Now 2 POST /save
+	SaveStatus       Endpoint = "save/status"      // /save/status/<job_id>
+)
+
+// Capture is an archived capture served by the fake.
+type Capture struct {
+	URL        string
+	Timestamp  time.Time
+	StatusCode int         // Defaults to 200.
+	MimeType   string      // Defaults to "text/html".
+	Header     http.Header // Other archived response headers, e.g. Location.
+	Body       string
+	Reason     string // Reported by calendarcaptures and surfaced as Snapshot.Reason.
+}
+
+// Fault replaces or delays the normal response of an endpoint.
+type Fault struct {
+	StatusCode        int           // Respond with this HTTP status instead, e.g. 403, 429 or 503.
+	RetryAfter        time.Duration // Retry-After header sent along with StatusCode.
+	Body              string        // Body sent along with StatusCode, e.g. "robots.txt" to make a 403 an exclusion.
+	Delay             time.Duration // Wait this long before responding, or until the request is canceled.
+	NoContentLocation bool          // Omit the Content-Location header of legacy /save/ responses.
+	Times             int           // Number of requests affected; 0 means every subsequent request.
+}
+
+// Server is a fake Wayback Machine running on a local httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	captures []Capture
+	warc     bytes.Buffer // Captures serialized as WARC response records.
+	index    *archiveorg.CDXIndex
+	faults   map[Endpoint][]*Fault
+	requests map[Endpoint]int
+	jobs     map[string]Capture // Save Page Now 2 jobs by ID.
+}
+
+// NewServer starts a fake Wayback Machine serving captures.  Callers should
+// Close it when finished.
+func NewServer(captures ...Capture) *Server {
+	s := &Server{
+		index:    archiveorg.NewCDXIndex(),
+		faults:   map[Endpoint][]*Fault{},
+		requests: map[Endpoint]int{},
+		jobs:     map[string]Capture{},
+	}
+	if err := s.Add(captures...); err != nil {
+		panic(fmt.Sprintf("archiveorgtest: %s", err))
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a client pointed at the fake which retries without
+// meaningful backoff delays.
+func (s *Server) Client() *archiveorg.Client {
+	c := archiveorg.NewClient()
+	c.BaseURL = s.URL
+	c.HTTPHost = ""
+	c.RetryPolicy = &archiveorg.BackOffRetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     10 * time.Millisecond,
+		Multiplier:      2,
+		MaxElapsedTime:  5 * time.Second,
+	}
+	return c
+}
+
+// Add archives more captures.
+func (s *Server) Add(captures ...Capture) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(captures...)
+}
+
+func (s *Server) add(captures ...Capture) error {
+	ww := archiveorg.NewWARCWriter(&s.warc, false)
+	for _, capture := range captures {
+		if capture.StatusCode == 0 {
+			capture.StatusCode = http.StatusOK
+		}
+		if capture.MimeType == "" {
+			capture.MimeType = "text/html"
+		}
+		capture.Timestamp = capture.Timestamp.UTC().Truncate(time.Second)
+
+		var block bytes.Buffer
+		fmt.Fprintf(&block, "HTTP/1.1 %v %v\r\nContent-Type: %v\r\n", capture.StatusCode, http.StatusText(capture.StatusCode), capture.MimeType)
+		capture.Header.Write(&block)
+		fmt.Fprintf(&block, "Content-Length: %v\r\n\r\n%v", len(capture.Body), capture.Body)
+
+		rec := &archiveorg.WARCRecord{
+			Type:        archiveorg.WARCResponse,
+			Date:        capture.Timestamp,
+			TargetURI:   capture.URL,
+			ContentType: "application/http;msgtype=response",
+			Block:       block.Bytes(),
+		}
+		if err := ww.WriteRecord(rec); err != nil {
+			return err
+		}
+		s.captures = append(s.captures, capture)
+	}
+
+	records, err := archiveorg.IndexWARC(bytes.NewReader(s.warc.Bytes()), warcFilename)
+	if err != nil {
+		return err
+	}
+	s.index = archiveorg.NewCDXIndex(records...)
+	return nil
+}
+
+// Captures returns all captures, including those made through Save Page Now.
+func (s *Server) Captures() []Capture {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Capture(nil), s.captures...)
+}
+
+// Inject queues a fault for endpoint.  Faults apply in the order injected; one
+// with Times == 0 stays in effect until Reset.
+func (s *Server) Inject(endpoint Endpoint, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[endpoint] = append(s.faults[endpoint], &fault)
+}
+
+// Reset removes all injected faults and clears the request counts.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = map[Endpoint][]*Fault{}
+	s.requests = map[Endpoint]int{}
+}
+
+// Requests returns the number of requests received by endpoint, including
+// those answered with a fault.
+func (s *Server) Requests(endpoint Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[endpoint]
+}
+
+// endpointFor classifies a request.  The raw path is used since the archived
+// URLs in it contain "//", which http.ServeMux would clean.
+func endpointFor(r *http.Request) (Endpoint, bool) {
+	path := r.URL.Path
+	switch {
+	case path == "/__wb/sparkline":
+		return Sparkline, true
+	case path == "/__wb/calendarcaptures":
+		return CalendarCaptures, true
+	case path == "/wayback/available":
+		return Available, true
+	case path == "/cdx/search/cdx":
+		return CDX, true
+	case strings.HasPrefix(path, "/web/timemap/"):
+		return TimeMap, true
+	case strings.HasPrefix(path, "/web/"):
+		return Replay, true
+	case strings.HasPrefix(path, "/save/status/"):
+		return SaveStatus, true
+	case path == "/save" || strings.HasPrefix(path, "/save/"):
+		return Save, true
+	}
+	return "", false
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := endpointFor(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	fault := s.nextFault(endpoint)
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.StatusCode != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((fault.RetryAfter+time.Second-1)/time.Second)))
+		}
+		http.Error(w, fault.Body, fault.StatusCode)
+		return
+	}
+
+	switch endpoint {
+	case Sparkline:
+		s.serveSparkline(w, r)
+	case CalendarCaptures:
+		s.serveCalendarCaptures(w, r)
+	case Save:
+		s.serveSave(w, r, fault)
+	case SaveStatus:
+		s.serveSaveStatus(w, r)
+	default:
+		s.replayServer().ServeHTTP(w, r)
+	}
+}
+
+// nextFault counts the request and returns the fault to apply to it, if any.
+func (s *Server) nextFault(endpoint Endpoint) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[endpoint]++
+
+	faults := s.faults[endpoint]
+	if len(faults) == 0 {
+		return Fault{}
+	}
+	fault := faults[0]
+	if fault.Times > 0 {
+		if fault.Times--; fault.Times == 0 {
+			s.faults[endpoint] = faults[1:]
+		}
+	}
+	return *fault
+}
+
+// replayServer serves the CDX, availability, TimeMap and replay endpoints from
+// the current fixtures.
+func (s *Server) replayServer() *server.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return server.New(s.index, memFS{warcFilename: s.warc.Bytes()})
+}
+
+// matching returns the captures of u, oldest first.
+func (s *Server) matching(u string) []Capture {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := archiveorg.SURT(u)
+	captures := []Capture{}
+	for _, capture := range s.captures {
+		if archiveorg.SURT(capture.URL) == key {
+			captures = append(captures, capture)
+		}
+	}
+	sort.SliceStable(captures, func(i, j int) bool {
+		return captures[i].Timestamp.Before(captures[j].Timestamp)
+	})
+	return captures
+}
+
+// serveSparkline reports the number of captures per month of each year.
+func (s *Server) serveSparkline(w http.ResponseWriter, r *http.Request) {
+	var (
+		captures = s.matching(r.URL.Query().Get("url"))
+		result   = map[string]interface{}{}
+		years    = map[string][]int{}
+	)
+	for _, capture := range captures {
+		year := strconv.Itoa(capture.Timestamp.Year())
+		if years[year] == nil {
+			years[year] = make([]int, 12)
+		}
+		years[year][capture.Timestamp.Month()-1]++
+	}
+	result["years"] = years
+	if len(captures) > 0 {
+		result["first_ts"] = captures[0].Timestamp.Format(timestampLayout)
+		result["last_ts"] = captures[len(captures)-1].Timestamp.Format(timestampLayout)
+	}
+	writeJSON(w, result)
+}
+
+// serveCalendarCaptures lists the captures of the selected year, one entry
+// per month holding a point per day with captures.
+func (s *Server) serveCalendarCaptures(w http.ResponseWriter, r *http.Request) {
+	type point struct {
+		Count       int        `json:"cnt"`
+		Whys        [][]string `json:"why"`
+		StatusCodes []int      `json:"st"`
+		Timestamps  []int64    `json:"ts"`
+	}
+
+	year, err := strconv.Atoi(r.URL.Query().Get("selected_year"))
+	if err != nil {
+		http.Error(w, "invalid selected_year", http.StatusBadRequest)
+		return
+	}
+
+	months := make([][][]*point, 12)
+	for i := range months {
+		months[i] = [][]*point{{}}
+	}
+	days := map[string]*point{}
+	for _, capture := range s.matching(r.URL.Query().Get("url")) {
+		if capture.Timestamp.Year() != year {
+			continue
+		}
+		day := capture.Timestamp.Format("20060102")
+		p, ok := days[day]
+		if !ok {
+			p = &point{}
+			days[day] = p
+			month := capture.Timestamp.Month() - 1
+			months[month][0] = append(months[month][0], p)
+		}
+		ts, _ := strconv.ParseInt(capture.Timestamp.Format(timestampLayout), 10, 64)
+		p.Count++
+		p.Whys = append(p.Whys, []string{capture.Reason})
+		p.StatusCodes = append(p.StatusCodes, capture.StatusCode)
+		p.Timestamps = append(p.Timestamps, ts)
+	}
+	writeJSON(w, months)
+}
+
+// serveSave archives the requested URL right away, as the legacy /save/<url>
+// endpoint or a Save Page Now 2 job which succeeds immediately.
+func (s *Server) serveSave(w http.ResponseWriter, r *http.Request, fault Fault) {
+	spn2 := r.URL.Path == "/save"
+
+	u := strings.TrimPrefix(r.URL.Path, "/save/")
+	if spn2 {
+		u = r.FormValue("url")
+	} else if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	if u == "" {
+		http.Error(w, "missing url", http.StatusBadRequest)
+		return
+	}
+
+	capture := Capture{
+		URL:       u,
+		Timestamp: time.Now(),
+		Reason:    "save page now",
+	}
+	s.mu.Lock()
+	if err := s.add(capture); err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	capture = s.captures[len(s.captures)-1]
+	jobID := fmt.Sprintf("spn2-%v", len(s.captures))
+	if spn2 {
+		s.jobs[jobID] = capture
+	}
+	s.mu.Unlock()
+
+	if spn2 {
+		writeJSON(w, map[string]string{"url": u, "job_id": jobID})
+		return
+	}
+	if !fault.NoContentLocation {
+		w.Header().Set("Content-Location", fmt.Sprintf("/web/%v/%v", capture.Timestamp.Format(timestampLayout), u))
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, capture.Body)
+}
+
+// serveSaveStatus reports Save Page Now 2 jobs as successful.
+func (s *Server) serveSaveStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := strings.TrimPrefix(r.URL.Path, "/save/status/")
+
+	s.mu.Lock()
+	capture, ok := s.jobs[jobID]
+	s.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, map[string]string{"status": "error", "job_id": jobID, "status_ext": "error:not-found", "message": "Job not found"})
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"status":       "success",
+		"job_id":       jobID,
+		"original_url": capture.URL,
+		"timestamp":    capture.Timestamp.Format(timestampLayout),
+		"duration_sec": 0,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// memFS is an in-memory http.FileSystem.
+type memFS map[string][]byte
+
+func (fs memFS) Open(name string) (http.File, error) {
+	data, ok := fs[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return memFile{bytes.NewReader(data)}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error {
+	return nil
+}
+
+func (memFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
+
+func (memFile) Stat() (os.FileInfo, error) {
+	return nil, errors.New("stat not supported")
+}
@@ -0,0 +1,162 @@
+package archiveorgtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"jaytaylor.com/archive.org"
+)
+
+var fixtures = []Capture{
+	{URL: "https://jaytaylor.com/", Timestamp: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), Body: "v1", Reason: "crawl"},
+	{URL: "https://jaytaylor.com/", Timestamp: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC), Body: "v1"},
+	{URL: "https://jaytaylor.com/", Timestamp: time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), StatusCode: http.StatusNotFound},
+	{URL: "https://jaytaylor.com/", Timestamp: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), Body: "v2"},
+	{URL: "https://jaytaylor.com/other", Timestamp: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func TestSearch(t *testing.T) {
+	s := NewServer(fixtures...)
+	defer s.Close()
+
+	snaps, err := s.Client().Search("https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, len(snaps); actual != expected {
+		t.Fatalf("Expected %v snapshots but actual=%v: %+v", expected, actual, snaps)
+	}
+	// Newest first.
+	if expected, actual := s.URL+"/web/20190301000000/https://jaytaylor.com/", snaps[0].URL; actual != expected {
+		t.Errorf("Expected snaps[0].URL=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 404, snaps[1].StatusCode; actual != expected {
+		t.Errorf("Expected snaps[1].StatusCode=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "crawl", snaps[3].Reason; actual != expected {
+		t.Errorf("Expected snaps[3].Reason=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestTimeMapFor(t *testing.T) {
+	s := NewServer(fixtures...)
+	defer s.Close()
+
+	defer func(baseURL, httpHost string) { archiveorg.BaseURL, archiveorg.HTTPHost = baseURL, httpHost }(archiveorg.BaseURL, archiveorg.HTTPHost)
+	archiveorg.BaseURL, archiveorg.HTTPHost = s.URL, ""
+
+	timemap, err := archiveorg.TimeMapFor("https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, len(timemap.Mementos); actual != expected {
+		t.Errorf("Expected %v mementos but actual=%v", expected, actual)
+	}
+	for _, m := range []*archiveorg.Memento{timemap.Original, timemap.Self, timemap.TimeGate} {
+		if m == nil || m.URL == "" {
+			t.Errorf("Expected original, self and timegate links but actual=%+v", timemap)
+		}
+	}
+}
+
+func TestClosestAndFetch(t *testing.T) {
+	s := NewServer(fixtures...)
+	defer s.Close()
+
+	c := s.Client()
+
+	snap, err := c.Closest("https://jaytaylor.com/", time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The 404 capture is skipped by the availability API.
+	if expected, actual := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC), snap.Timestamp; !actual.Equal(expected) {
+		t.Errorf("Expected closest=%v but actual=%v", expected, actual)
+	}
+
+	content, err := c.FetchSnapshot("https://jaytaylor.com/", snap.Timestamp, archiveorg.ModifierIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "v2", string(content.Body); actual != expected {
+		t.Errorf("Expected body=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	defer func(interval time.Duration) { archiveorg.CaptureStatusPollInterval = interval }(archiveorg.CaptureStatusPollInterval)
+	archiveorg.CaptureStatusPollInterval = time.Millisecond
+
+	s := NewServer()
+	defer s.Close()
+
+	c := s.Client()
+
+	location, err := c.Capture("https://jaytaylor.com/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	captures := s.Captures()
+	if len(captures) != 1 || location != s.URL+"/web/"+captures[0].Timestamp.Format(timestampLayout)+"/https://jaytaylor.com/new" {
+		t.Errorf("Unexpected location=%v for captures=%+v", location, captures)
+	}
+
+	s.Inject(Save, Fault{NoContentLocation: true, Times: 1})
+	if _, err := c.Capture("https://jaytaylor.com/new"); err != archiveorg.NoContentLocationErr {
+		t.Errorf("Expected NoContentLocationErr but actual=%v", err)
+	}
+
+	// Save Page Now 2 captures are immediately available.
+	c.AccessKey, c.SecretKey = "key", "secret"
+	snap, err := c.CaptureAndWait(context.Background(), "https://jaytaylor.com/spn2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.FetchSnapshot("https://jaytaylor.com/spn2", snap.Timestamp, archiveorg.ModifierIdentity); err != nil {
+		t.Errorf("Expected SPN2 capture to be replayable: %s", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := NewServer(fixtures...)
+	defer s.Close()
+
+	c := s.Client()
+
+	// Transient failures are retried.
+	s.Inject(TimeMap, Fault{StatusCode: http.StatusTooManyRequests, Times: 1})
+	s.Inject(TimeMap, Fault{StatusCode: http.StatusServiceUnavailable, Times: 1})
+	if _, err := c.TimeMap("https://jaytaylor.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 3, s.Requests(TimeMap); actual != expected {
+		t.Errorf("Expected %v timemap requests but actual=%v", expected, actual)
+	}
+
+	s.Inject(Sparkline, Fault{StatusCode: http.StatusForbidden, Body: "Blocked by robots.txt"})
+	if _, err := c.Search("https://jaytaylor.com/"); !errors.Is(err, archiveorg.ErrExcluded) {
+		t.Errorf("Expected ErrExcluded but actual=%v", err)
+	}
+	if expected, actual := 1, s.Requests(Sparkline); actual != expected {
+		t.Errorf("Expected exclusions not to be retried, but saw %v requests", actual)
+	}
+
+	s.Reset()
+	s.Inject(TimeMap, Fault{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute})
+	_, err := c.TimeMap("https://jaytaylor.com/")
+	var httpErr *archiveorg.HTTPError
+	if !errors.Is(err, archiveorg.ErrRateLimited) || !errors.As(err, &httpErr) || httpErr.RetryAfter != time.Minute {
+		t.Errorf("Expected ErrRateLimited with a one minute Retry-After but actual=%v", err)
+	}
+
+	s.Reset()
+	s.Inject(CDX, Fault{Delay: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CDXContext(ctx, archiveorg.CDXQuery{URL: "jaytaylor.com"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded but actual=%v", err)
+	}
+}
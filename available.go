@@ -0,0 +1,138 @@
+package archiveorg
+
+// Availability API client as documented at https://archive.org/help/wayback_api.php.
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NotArchivedErr is an alias of ErrNotArchived, kept for compatibility.
+var NotArchivedErr = ErrNotArchived
+
+type availableResponse struct {
+	URL               string `json:"url"`
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Status    string `json:"status"`
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// Closest finds the snapshot of u closest to t using the package-level default
+// client settings.
+func Closest(u string, t time.Time, timeout ...time.Duration) (*Snapshot, error) {
+	return defaultClient(timeout...).Closest(u, t)
+}
+
+// ClosestContext is like Closest but aborts when ctx is done.
+func ClosestContext(ctx context.Context, u string, t time.Time, timeout ...time.Duration) (*Snapshot, error) {
+	return defaultClient(timeout...).ClosestContext(ctx, u, t)
+}
+
+// Closest finds the snapshot of u closest to t.
+func (c *Client) Closest(u string, t time.Time) (*Snapshot, error) {
+	return c.ClosestContext(context.Background(), u, t)
+}
+
+// ClosestContext finds the snapshot of u closest to t via the /wayback/available
+// endpoint, falling back to the TimeMap when the availability API comes up
+// empty or fails.  With a LocalIndex the index is consulted instead.
+// ErrNotArchived is returned when no snapshot exists.
+func (c *Client) ClosestContext(ctx context.Context, u string, t time.Time) (*Snapshot, error) {
+	if c.LocalIndex != nil {
+		return c.closestLocalIndex(u, t)
+	}
+
+	snap, err := c.available(ctx, u, t)
+	if err == nil {
+		return snap, nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	log.WithField("url", u).Debugf("Availability lookup failed, falling back to TimeMap: %s", err)
+
+	timemap, err := c.TimeMapContext(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return closestMemento(timemap, t)
+}
+
+// closestLocalIndex answers Closest from c.LocalIndex, considering successful
+// and redirect captures like the availability API does.
+func (c *Client) closestLocalIndex(u string, t time.Time) (*Snapshot, error) {
+	records, err := c.LocalIndex.Search(CDXQuery{
+		URL:     u,
+		Closest: t,
+		Limit:   1,
+		Filters: []string{"statuscode:[23]..|-"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotArchived
+	}
+	snap := c.cdxSnapshot(records[0])
+	return &snap, nil
+}
+
+// available queries the /wayback/available endpoint.
+func (c *Client) available(ctx context.Context, u string, t time.Time) (*Snapshot, error) {
+	v := url.Values{}
+	v.Set("url", u)
+	if !t.IsZero() {
+		v.Set("timestamp", t.UTC().Format(timestampLayout))
+	}
+	queryURL := fmt.Sprintf("%v/wayback/available?%v", c.BaseURL, v.Encode())
+
+	result := &availableResponse{}
+	if _, err := c.simpleHTTPJSON(ctx, queryURL, result); err != nil {
+		return nil, err
+	}
+
+	closest := result.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available {
+		return nil, ErrNotArchived
+	}
+
+	ts, err := ParseTimestamp(closest.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		URL:       closest.URL,
+		Timestamp: ts,
+	}
+	if sc, err := strconv.Atoi(closest.Status); err == nil {
+		snap.StatusCode = sc
+	}
+	return snap, nil
+}
+
+// closestMemento picks the memento nearest to t.
+func closestMemento(timemap *TimeMap, t time.Time) (*Snapshot, error) {
+	best := timemap.Nearest(t)
+	if best == nil {
+		return nil, ErrNotArchived
+	}
+
+	snap := &Snapshot{
+		URL:       best.URL,
+		Timestamp: *best.Time,
+	}
+	return snap, nil
+}
@@ -0,0 +1,48 @@
+package archiveorg
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClosest(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "20150601000000", r.URL.Query().Get("timestamp"); actual != expected {
+			t.Errorf("Expected timestamp=%v but actual=%v", expected, actual)
+		}
+		fmt.Fprint(w, `{"url":"jaytaylor.com","archived_snapshots":{"closest":{"status":"200","available":true,"url":"http://web.archive.org/web/20150527024618/http://jaytaylor.com:80/","timestamp":"20150527024618"}}}`)
+	}))
+
+	snap, err := c.Closest("jaytaylor.com", time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := time.Date(2015, 5, 27, 2, 46, 18, 0, time.UTC), snap.Timestamp; !actual.Equal(expected) {
+		t.Errorf("Expected timestamp=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 200, snap.StatusCode; actual != expected {
+		t.Errorf("Expected status code=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestClosestTimeMapFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wayback/available", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"url":"jaytaylor.com","archived_snapshots":{}}`)
+	})
+	mux.HandleFunc("/web/timemap/link/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.TrimSpace(rawTimeMap)+"\n")
+	})
+	c := newTestClient(t, mux)
+
+	snap, err := c.Closest("https://jaytaylor.com", time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "http://web.archive.org/web/20150527024618/http://jaytaylor.com:80/", snap.URL; actual != expected {
+		t.Errorf("Expected URL=%v but actual=%v", expected, actual)
+	}
+}
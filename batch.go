@@ -0,0 +1,143 @@
+package archiveorg
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchOptions control CaptureBatch.
+type BatchOptions struct {
+	Concurrency    int           // Number of concurrent capture workers; defaults to 1.
+	HostDelay      time.Duration // Minimum delay between captures of URLs on the same host.
+	Wait           bool          // Wait for each snapshot to become available, see CaptureAndWait.
+	WaitTimeout    time.Duration // Per-URL limit on waiting when Wait is set; zero means no limit.
+	CaptureOptions CaptureOptions
+}
+
+// CaptureResult is the outcome of capturing a single URL in a batch.
+type CaptureResult struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"` // "ok" or "error".
+	Archived string `json:"archived,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Err      error  `json:"-"`
+}
+
+// CaptureBatch captures every URL received from urls using a pool of workers,
+// sending one result per URL on the returned channel.  The result channel is
+// closed once urls is closed and all captures have finished, or ctx is done.
+func (c *Client) CaptureBatch(ctx context.Context, urls <-chan string, opts BatchOptions) <-chan CaptureResult {
+	var (
+		results = make(chan CaptureResult)
+		gate    = newHostGate(opts.HostDelay)
+		wg      sync.WaitGroup
+		workers = opts.Concurrency
+	)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range urls {
+				result := c.captureOne(ctx, gate, u, opts)
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func (c *Client) captureOne(ctx context.Context, gate *hostGate, u string, opts BatchOptions) CaptureResult {
+	result := CaptureResult{
+		URL: u,
+	}
+
+	err := gate.wait(ctx, u)
+	if err == nil {
+		if opts.Wait {
+			waitCtx := ctx
+			if opts.WaitTimeout > 0 {
+				var cancel context.CancelFunc
+				waitCtx, cancel = context.WithTimeout(ctx, opts.WaitTimeout)
+				defer cancel()
+			}
+			var snap *Snapshot
+			if snap, err = c.CaptureAndWait(waitCtx, u, opts.CaptureOptions); err == nil {
+				result.Archived = snap.URL
+			}
+		} else {
+			result.Archived, err = c.CaptureContext(ctx, u, opts.CaptureOptions)
+		}
+	}
+
+	if err != nil {
+		log.WithField("url", u).Warnf("Capture failed: %s", err)
+		result.Status = "error"
+		result.Error = err.Error()
+		result.Err = err
+	} else {
+		result.Status = "ok"
+	}
+	return result
+}
+
+// hostGate spaces out requests to the same host by a fixed delay.
+type hostGate struct {
+	delay time.Duration
+	next  map[string]time.Time
+	mu    sync.Mutex
+}
+
+func newHostGate(delay time.Duration) *hostGate {
+	g := &hostGate{
+		delay: delay,
+		next:  map[string]time.Time{},
+	}
+	return g
+}
+
+// wait blocks until a request to the host of rawURL is allowed.
+func (g *hostGate) wait(ctx context.Context, rawURL string) error {
+	if g.delay <= 0 {
+		return nil
+	}
+
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	g.mu.Lock()
+	now := time.Now()
+	at := g.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	g.next[host] = at.Add(g.delay)
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(at.Sub(now)):
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package archiveorg
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureBatch(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Location", "web/20180326070330"+strings.TrimPrefix(r.URL.Path, "/save"))
+	}))
+
+	urls := make(chan string, 3)
+	urls <- "https://jaytaylor.com/a"
+	urls <- "https://jaytaylor.com/fail"
+	urls <- "https://example.com/"
+	close(urls)
+
+	results := map[string]CaptureResult{}
+	for result := range c.CaptureBatch(context.Background(), urls, BatchOptions{Concurrency: 2}) {
+		results[result.URL] = result
+	}
+
+	if expected, actual := 3, len(results); actual != expected {
+		t.Fatalf("Expected num results=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "ok", results["https://example.com/"].Status; actual != expected {
+		t.Errorf("Expected status=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "error", results["https://jaytaylor.com/fail"].Status; actual != expected {
+		t.Errorf("Expected status=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestHostGate(t *testing.T) {
+	var (
+		delay = 50 * time.Millisecond
+		gate  = newHostGate(delay)
+		ctx   = context.Background()
+		start = time.Now()
+	)
+
+	for _, u := range []string{"https://jaytaylor.com/a", "https://example.com/", "https://jaytaylor.com/b"} {
+		if err := gate.wait(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Expected second request to the same host to be delayed by at least %s but elapsed=%s", delay, elapsed)
+	}
+}
@@ -1,26 +1,213 @@
 package archiveorg
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-var NoContentLocationErr = errors.New("missing 'content-lcation' header") // Returned when a malformed response is returned by archive.org.
+var (
+	NoContentLocationErr = errors.New("missing 'content-lcation' header") // Returned when a malformed response is returned by archive.org.
 
-// Capture requests a
+	CaptureStatusPollInterval = 5 * time.Second // How often CaptureStatus checks on a pending Save Page Now 2 job.
+)
+
+// CaptureOptions control how a Save Page Now 2 capture is made.  They are
+// ignored by the legacy capture endpoint used when no AccessKey is configured.
+type CaptureOptions struct {
+	CaptureAll          bool          // Also capture error pages (4xx/5xx).
+	CaptureOutlinks     bool          // Also capture the outlinks of the page.
+	CaptureScreenshot   bool          // Also capture a full page screenshot.
+	SkipFirstArchive    bool          // Skip checking whether this is the first archive of the URL; makes captures faster.
+	ForceGet            bool          // Force the use of a simple HTTP GET request instead of a headless browser.
+	DelayWBAvailability bool          // Make the capture available in the Wayback Machine after ~12 hours, reducing load.
+	JSBehaviorTimeout   time.Duration // Run JS code for this long after page load to trigger dynamic content (max 30s); zero uses the server default.
+	IfNotArchivedWithin time.Duration // Only capture when the latest existing capture is older than this.
+}
+
+// Values encodes the options as SPN2 form parameters.
+func (opts CaptureOptions) Values() url.Values {
+	v := url.Values{}
+	flags := []struct {
+		name    string
+		enabled bool
+	}{
+		{"capture_all", opts.CaptureAll},
+		{"capture_outlinks", opts.CaptureOutlinks},
+		{"capture_screenshot", opts.CaptureScreenshot},
+		{"skip_first_archive", opts.SkipFirstArchive},
+		{"force_get", opts.ForceGet},
+		{"delay_wb_availability", opts.DelayWBAvailability},
+	}
+	for _, flag := range flags {
+		if flag.enabled {
+			v.Set(flag.name, "1")
+		}
+	}
+	if opts.JSBehaviorTimeout > 0 {
+		v.Set("js_behavior_timeout", strconv.Itoa(int(opts.JSBehaviorTimeout/time.Second)))
+	}
+	if opts.IfNotArchivedWithin > 0 {
+		v.Set("if_not_archived_within", strconv.Itoa(int(opts.IfNotArchivedWithin/time.Second)))
+	}
+	return v
+}
+
+// CaptureJob describes the state of a Save Page Now 2 capture job, as reported
+// by /save/status/<job_id>.
+type CaptureJob struct {
+	JobID       string
+	Status      string    // One of "pending", "success" or "error".
+	StatusExt   string    // Error code when Status is "error", e.g. "error:too-many-daily-captures".
+	Message     string    // Human readable error description.
+	Exception   string    // Underlying exception, if any.
+	OriginalURL string    // URL that was captured, after any redirects.
+	Timestamp   time.Time // Timestamp of the resulting snapshot.
+	Duration    time.Duration
+	Outlinks    []string
+	Resources   []string
+}
+
+// Done returns true once the job has reached a terminal state, i.e. any
+// status other than "pending".
+func (job *CaptureJob) Done() bool {
+	return job.Status != "pending"
+}
+
+// UnmarshalJSON decodes the SPN2 status payload, where "outlinks" may be either
+// a list of URLs or an object keyed by URL.
+func (job *CaptureJob) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		JobID       string          `json:"job_id"`
+		Status      string          `json:"status"`
+		StatusExt   string          `json:"status_ext"`
+		Message     string          `json:"message"`
+		Exception   string          `json:"exception"`
+		OriginalURL string          `json:"original_url"`
+		Timestamp   string          `json:"timestamp"`
+		DurationSec float64         `json:"duration_sec"`
+		Outlinks    json.RawMessage `json:"outlinks"`
+		Resources   []string        `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*job = CaptureJob{
+		JobID:       raw.JobID,
+		Status:      raw.Status,
+		StatusExt:   raw.StatusExt,
+		Message:     raw.Message,
+		Exception:   raw.Exception,
+		OriginalURL: raw.OriginalURL,
+		Duration:    time.Duration(raw.DurationSec * float64(time.Second)),
+		Resources:   raw.Resources,
+	}
+
+	if raw.Timestamp != "" {
+		ts, err := ParseTimestamp(raw.Timestamp)
+		if err != nil {
+			return err
+		}
+		job.Timestamp = ts
+	}
+
+	if len(raw.Outlinks) > 0 {
+		if err := json.Unmarshal(raw.Outlinks, &job.Outlinks); err != nil {
+			byURL := map[string]interface{}{}
+			if err := json.Unmarshal(raw.Outlinks, &byURL); err != nil {
+				return fmt.Errorf("decoding outlinks: %s", err)
+			}
+			for u := range byURL {
+				job.Outlinks = append(job.Outlinks, u)
+			}
+			sort.Strings(job.Outlinks)
+		}
+	}
+
+	return nil
+}
+
+// Capture requests a fresh crawl of url using the package-level default client
+// settings.
 func Capture(url string, timeout ...time.Duration) (string, error) {
-	if len(timeout) == 0 {
-		timeout = []time.Duration{DefaultRequestTimeout}
+	return defaultClient(timeout...).Capture(url)
+}
+
+// CaptureContext is like Capture but aborts when ctx is done.
+func CaptureContext(ctx context.Context, url string, timeout ...time.Duration) (string, error) {
+	return defaultClient(timeout...).CaptureContext(ctx, url)
+}
+
+// CaptureWithOptions is like Capture but applies opts to Save Page Now 2
+// captures.
+func CaptureWithOptions(url string, opts CaptureOptions, timeout ...time.Duration) (string, error) {
+	return defaultClient(timeout...).Capture(url, opts)
+}
+
+// SubmitCapture submits a Save Page Now 2 capture job using the package-level
+// default client settings.
+func SubmitCapture(url string, opts CaptureOptions, timeout ...time.Duration) (string, error) {
+	return defaultClient(timeout...).SubmitCapture(url, opts)
+}
+
+// CaptureAndWait requests a fresh crawl of url and blocks until the snapshot is
+// available, using the package-level default client settings.
+func CaptureAndWait(ctx context.Context, url string, opts CaptureOptions, timeout ...time.Duration) (*Snapshot, error) {
+	return defaultClient(timeout...).CaptureAndWait(ctx, url, opts)
+}
+
+// CaptureStatus polls a Save Page Now 2 capture job using the package-level
+// default client settings.
+func CaptureStatus(jobID string, timeout ...time.Duration) (*CaptureJob, error) {
+	return defaultClient(timeout...).CaptureStatus(jobID)
+}
+
+// Capture requests a fresh crawl of url and returns the resulting snapshot
+// location.  At most one CaptureOptions may be given.
+func (c *Client) Capture(url string, opts ...CaptureOptions) (string, error) {
+	return c.CaptureContext(context.Background(), url, opts...)
+}
+
+// CaptureContext requests a fresh crawl of url, aborting the request when ctx
+// is done.
+//
+// When the client has an AccessKey the Save Page Now 2 API is used and the call
+// blocks until the capture job completes.  Otherwise the legacy /save/<url>
+// endpoint is used, which depends on a 'Content-Location' response header.
+func (c *Client) CaptureContext(ctx context.Context, url string, opts ...CaptureOptions) (string, error) {
+	if c.AccessKey != "" {
+		job, err := c.captureSPN2(ctx, url, opts...)
+		if err != nil {
+			return "", err
+		}
+		return c.snapshotURL(job.Timestamp, job.OriginalURL), nil
+	}
+	if len(opts) > 0 && opts[0] != (CaptureOptions{}) {
+		log.WithField("url", url).Warn("Ignoring capture options, which require an access key")
 	}
 
-	pleaseCrawl := fmt.Sprintf("%v/save/%v", BaseURL, url)
+	pleaseCrawl := fmt.Sprintf("%v/save/%v", c.BaseURL, url)
 
 	log.WithField("crawl-request", pleaseCrawl).Debugf("Requesting archive.org crawl")
 
-	resp, _, err := doRequest("", pleaseCrawl, nil, timeout[0])
+	var resp *http.Response
+	err := c.retry(ctx, pleaseCrawl, func() error {
+		var err error
+		resp, _, err = c.doRequest(ctx, "", pleaseCrawl, nil)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -31,7 +218,234 @@ func Capture(url string, timeout ...time.Duration) (string, error) {
 		return "", NoContentLocationErr
 	}
 
-	location := fmt.Sprintf("%v/%v", BaseURL, loc)
+	location := fmt.Sprintf("%v/%v", c.BaseURL, strings.TrimPrefix(loc, "/"))
 
 	return location, nil
 }
+
+// captureSPN2 submits a Save Page Now 2 job and waits for it to succeed.
+func (c *Client) captureSPN2(ctx context.Context, url string, opts ...CaptureOptions) (*CaptureJob, error) {
+	jobID, err := c.SubmitCaptureContext(ctx, url, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := c.CaptureStatusContext(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != "success" {
+		return nil, &CaptureError{JobID: jobID, URL: url, StatusExt: job.StatusExt, Message: job.Message}
+	}
+
+	return job, nil
+}
+
+// CaptureAndWait requests a fresh crawl of url and blocks until the resulting
+// snapshot is available in the Wayback Machine, or ctx is done.
+//
+// With an AccessKey the Save Page Now 2 job status is followed, otherwise the
+// CDX index is polled for a capture made after the request was submitted.
+func (c *Client) CaptureAndWait(ctx context.Context, url string, opts ...CaptureOptions) (*Snapshot, error) {
+	if c.AccessKey != "" {
+		job, err := c.captureSPN2(ctx, url, opts...)
+		if err != nil {
+			return nil, err
+		}
+		snap := &Snapshot{
+			URL:       c.snapshotURL(job.Timestamp, job.OriginalURL),
+			Timestamp: job.Timestamp,
+		}
+		return snap, nil
+	}
+
+	since := time.Now().UTC().Truncate(time.Second)
+
+	if _, err := c.CaptureContext(ctx, url, opts...); err != nil && err != NoContentLocationErr {
+		return nil, err
+	}
+
+	return c.WaitAvailable(ctx, url, since)
+}
+
+// WaitAvailable polls the CDX index until a capture of url made at or after
+// since shows up, or ctx is done.
+func (c *Client) WaitAvailable(ctx context.Context, url string, since time.Time) (*Snapshot, error) {
+	q := CDXQuery{
+		URL:    url,
+		From:   since,
+		Limit:  -1,
+		Fields: []string{"timestamp", "original", "statuscode"},
+	}
+
+	for {
+		records, err := c.CDXContext(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > 0 {
+			snap := c.cdxSnapshot(records[len(records)-1])
+			return &snap, nil
+		}
+
+		log.WithField("url", url).Debugf("Capture not yet available, checking again in %s", CaptureStatusPollInterval)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(CaptureStatusPollInterval):
+		}
+	}
+}
+
+// cdxSnapshot converts a CDX record to a Snapshot.
+func (c *Client) cdxSnapshot(record CDXRecord) Snapshot {
+	snap := Snapshot{
+		URL:        c.snapshotURL(record.Timestamp, record.Original),
+		StatusCode: record.StatusCode,
+		Timestamp:  record.Timestamp,
+	}
+	return snap
+}
+
+// snapshotURL returns the Wayback Machine replay URL for a capture of u at ts.
+func (c *Client) snapshotURL(ts time.Time, u string) string {
+	return fmt.Sprintf("%v/web/%v/%v", c.BaseURL, ts.Format(timestampLayout), u)
+}
+
+// SubmitCapture submits a Save Page Now 2 capture job for url and returns the
+// job ID.  At most one CaptureOptions may be given.
+func (c *Client) SubmitCapture(url string, opts ...CaptureOptions) (string, error) {
+	return c.SubmitCaptureContext(context.Background(), url, opts...)
+}
+
+// SubmitCaptureContext is like SubmitCapture but aborts when ctx is done.
+func (c *Client) SubmitCaptureContext(ctx context.Context, u string, opts ...CaptureOptions) (string, error) {
+	form := url.Values{}
+	if len(opts) > 0 {
+		form = opts[0].Values()
+	}
+	form.Set("url", u)
+
+	saveURL := fmt.Sprintf("%v/save", c.BaseURL)
+
+	log.WithField("url", u).Debug("Submitting Save Page Now 2 capture request")
+
+	var body []byte
+	err := c.retryIf(ctx, saveURL, submitRetryable, func() error {
+		req, err := c.newRequest(ctx, "POST", saveURL, ioutil.NopCloser(strings.NewReader(form.Encode())))
+		if err != nil {
+			return err
+		}
+		c.setSPN2Headers(req)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		_, body, err = c.do(req)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		URL       string `json:"url"`
+		JobID     string `json:"job_id"`
+		Status    string `json:"status"`
+		StatusExt string `json:"status_ext"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("decoding capture response: %s", err)
+	}
+	if result.JobID == "" {
+		return "", &CaptureError{URL: u, StatusExt: result.StatusExt, Message: result.Message}
+	}
+
+	return result.JobID, nil
+}
+
+// submitRetryable reports whether a failed Save Page Now 2 submission may be
+// sent again.  The POST is not idempotent: after a 5xx or a lost response the
+// job may well have been accepted, and resubmitting would duplicate the capture
+// and spend quota twice.  Only requests which never reached archive.org and
+// rate limited requests with a Retry-After are retried.
+func submitRetryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests && httpErr.RetryAfter > 0
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// CaptureStatus polls /save/status/<job_id> until the job succeeds or fails.
+//
+// A job which ended with Status "error" is returned without an error; inspect
+// StatusExt and Message for the reason.
+func (c *Client) CaptureStatus(jobID string) (*CaptureJob, error) {
+	return c.CaptureStatusContext(context.Background(), jobID)
+}
+
+// CaptureStatusContext is like CaptureStatus but aborts when ctx is done.
+func (c *Client) CaptureStatusContext(ctx context.Context, jobID string) (*CaptureJob, error) {
+	for {
+		job, err := c.captureJob(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+
+		log.WithField("job-id", jobID).Debugf("Capture job pending, checking again in %s", CaptureStatusPollInterval)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(CaptureStatusPollInterval):
+		}
+	}
+}
+
+// captureJob fetches the current state of a capture job once.
+func (c *Client) captureJob(ctx context.Context, jobID string) (*CaptureJob, error) {
+	statusURL := fmt.Sprintf("%v/save/status/%v", c.BaseURL, url.PathEscape(jobID))
+
+	var body []byte
+	err := c.retry(ctx, statusURL, func() error {
+		req, err := c.newRequest(ctx, "GET", statusURL, nil)
+		if err != nil {
+			return err
+		}
+		c.setSPN2Headers(req)
+
+		_, body, err = c.do(req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job := &CaptureJob{}
+	if err := json.Unmarshal(body, job); err != nil {
+		return nil, fmt.Errorf("decoding capture status: %s", err)
+	}
+	if job.JobID == "" {
+		job.JobID = jobID
+	}
+	if job.Status == "" {
+		// An error body or unknown schema; polling it would never finish.
+		if job.StatusExt != "" || job.Message != "" {
+			return nil, &CaptureError{JobID: jobID, URL: job.OriginalURL, StatusExt: job.StatusExt, Message: job.Message}
+		}
+		return nil, fmt.Errorf("capture status of job %v is missing a status: %s", jobID, body)
+	}
+	return job, nil
+}
+
+func (c *Client) setSPN2Headers(req *http.Request) {
+	req.Header.Set("Accept", "application/json")
+	if c.AccessKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("LOW %v:%v", c.AccessKey, c.SecretKey))
+	}
+}
@@ -0,0 +1,192 @@
+package archiveorg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCaptureSPN2(t *testing.T) {
+	defer func(interval time.Duration) { CaptureStatusPollInterval = interval }(CaptureStatusPollInterval)
+	CaptureStatusPollInterval = time.Millisecond
+
+	polls := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/save", func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "POST", r.Method; actual != expected {
+			t.Errorf("Expected method=%v but actual=%v", expected, actual)
+		}
+		if expected, actual := "LOW key:secret", r.Header.Get("Authorization"); actual != expected {
+			t.Errorf("Expected Authorization=%q but actual=%q", expected, actual)
+		}
+		if expected, actual := "https://jaytaylor.com/", r.FormValue("url"); actual != expected {
+			t.Errorf("Expected url=%v but actual=%v", expected, actual)
+		}
+		fmt.Fprint(w, `{"url":"https://jaytaylor.com/","job_id":"spn2-abc"}`)
+	})
+	mux.HandleFunc("/save/status/spn2-abc", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 3 {
+			fmt.Fprint(w, `{"status":"pending","job_id":"spn2-abc"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","job_id":"spn2-abc","original_url":"https://jaytaylor.com/","timestamp":"20180326070330","duration_sec":6.2,"outlinks":{"https://jaytaylor.com/b":"spn2-2","https://jaytaylor.com/a":"spn2-1"}}`)
+	})
+	c := newTestClient(t, mux)
+	c.AccessKey = "key"
+	c.SecretKey = "secret"
+
+	location, err := c.Capture("https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := c.BaseURL+"/web/20180326070330/https://jaytaylor.com/", location; actual != expected {
+		t.Errorf("Expected location=%v but actual=%v", expected, actual)
+	}
+
+	job, err := c.CaptureStatus("spn2-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(job.Outlinks); actual != expected {
+		t.Fatalf("Expected num outlinks=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "https://jaytaylor.com/a", job.Outlinks[0]; actual != expected {
+		t.Errorf("Expected outlinks[0]=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestCaptureStatusError(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"error","job_id":"spn2-err","status_ext":"error:blocked-url","message":"This URL is in the Save Page Now service block list"}`)
+	}))
+
+	job, err := c.CaptureStatus("spn2-err")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "error:blocked-url", job.StatusExt; actual != expected {
+		t.Errorf("Expected StatusExt=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestSubmitCaptureRetries(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		retryAfter string
+		expected   int
+	}{
+		{http.StatusServiceUnavailable, "", 1}, // The job may have been accepted.
+		{http.StatusBadGateway, "", 1},
+		{http.StatusTooManyRequests, "", 1},
+		{http.StatusTooManyRequests, "1", 2},
+	}
+	for i, testCase := range testCases {
+		requests := 0
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				if testCase.retryAfter != "" {
+					w.Header().Set("Retry-After", testCase.retryAfter)
+				}
+				w.WriteHeader(testCase.statusCode)
+				return
+			}
+			fmt.Fprint(w, `{"url":"https://jaytaylor.com/","job_id":"spn2-abc"}`)
+		}))
+		c.RetryPolicy = fastRetryPolicy()
+
+		c.SubmitCapture("https://jaytaylor.com/")
+		if requests != testCase.expected {
+			t.Errorf("[i=%v] Expected %v requests but actual=%v", i, testCase.expected, requests)
+		}
+	}
+
+	// Connection failures are retried since the request never reached the
+	// server.
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	transport := &countingTransport{}
+	c := NewClient()
+	c.BaseURL = ts.URL
+	c.HTTPHost = ""
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.MaxTries = 2
+	c.RetryPolicy = fastRetryPolicy()
+
+	if _, err := c.SubmitCapture("https://jaytaylor.com/"); err == nil {
+		t.Fatal("Expected a connection error")
+	}
+	if expected, actual := 3, transport.requests; actual != expected {
+		t.Errorf("Expected %v attempts but actual=%v", expected, actual)
+	}
+}
+
+func TestCaptureStatusMissing(t *testing.T) {
+	for _, body := range []string{`{"job_id":"spn2-abc"}`, `{"status_ext":"error:unauthorized","message":"You need to be logged in"}`} {
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if _, err := c.CaptureStatusContext(ctx, "spn2-abc"); err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("[body=%v] Expected an error about the missing status but actual=%v", body, err)
+		}
+		cancel()
+	}
+}
+
+func TestCaptureOptionsValues(t *testing.T) {
+	opts := CaptureOptions{
+		CaptureAll:          true,
+		CaptureOutlinks:     true,
+		JSBehaviorTimeout:   5 * time.Second,
+		IfNotArchivedWithin: 24 * time.Hour,
+	}
+	expected := "capture_all=1&capture_outlinks=1&if_not_archived_within=86400&js_behavior_timeout=5"
+	if actual := opts.Values().Encode(); actual != expected {
+		t.Errorf("Expected encoded options=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestCaptureAndWaitLegacy(t *testing.T) {
+	defer func(interval time.Duration) { CaptureStatusPollInterval = interval }(CaptureStatusPollInterval)
+	CaptureStatusPollInterval = time.Millisecond
+
+	polls := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/save/", func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Location header.
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/cdx/search/cdx", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("from") == "" {
+			t.Errorf("Expected from parameter to be set")
+		}
+		polls++
+		if polls < 2 {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[["timestamp","original","statuscode"],["20180326070330","https://jaytaylor.com/","200"]]`)
+	})
+	c := newTestClient(t, mux)
+
+	snap, err := c.CaptureAndWait(context.Background(), "https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := c.BaseURL+"/web/20180326070330/https://jaytaylor.com/", snap.URL; actual != expected {
+		t.Errorf("Expected snapshot URL=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 200, snap.StatusCode; actual != expected {
+		t.Errorf("Expected snapshot status code=%v but actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,307 @@
+package archiveorg
+
+// CDX Server API client as documented at
+// https://github.com/internetarchive/wayback/tree/master/wayback-cdx-server.
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MatchType controls how CDXQuery.URL is matched against the index.
+type MatchType string
+
+const (
+	MatchExact  MatchType = "exact"  // Only the exact URL.
+	MatchPrefix MatchType = "prefix" // All URLs under the given path.
+	MatchHost   MatchType = "host"   // All URLs on the given host.
+	MatchDomain MatchType = "domain" // All URLs on the given host and its subdomains.
+)
+
+// CDXQuery describes a search against the /cdx/search/cdx endpoint.  Zero
+// values are omitted from the request.
+type CDXQuery struct {
+	URL       string
+	From      time.Time // Inclusive lower bound on capture time.
+	To        time.Time // Inclusive upper bound on capture time.
+	Closest   time.Time // Sort results by distance from this time (sort=closest), nearest first; combine with Limit.
+	MatchType MatchType
+	Filters   []string // e.g. "statuscode:200" or "!mimetype:text/html".
+	Collapse  []string // e.g. "digest" or "timestamp:8".
+	Limit     int      // Negative values return the last N results.
+	Offset    int
+	Fields    []string // Field selection (fl), e.g. "timestamp", "original".
+
+	// Pagination, see CDXIterator for transparent handling.
+	ShowResumeKey bool   // Append a resume key when results are truncated by Limit.
+	ResumeKey     string // Continue a previous query from this key.
+	Page          int    // Page number to fetch; only sent when PageSize > 0.
+	PageSize      int    // Number of index blocks per page; enables paged mode.
+}
+
+// CDXRecord is a single capture line from the CDX index.  Fields which were not
+// selected by the query are left at their zero value.
+type CDXRecord struct {
+	URLKey     string
+	Timestamp  time.Time
+	Original   string
+	MimeType   string
+	StatusCode int
+	Digest     string
+	Length     int64
+	Redirect   string // Location of a redirect capture, when known.
+	Offset     int64  // Position of the record in Filename, for local indexes.
+	Filename   string // WARC or ARC file holding the record, for local indexes.
+}
+
+// Values encodes the query as CDX server URL parameters.
+func (q CDXQuery) Values() url.Values {
+	v := url.Values{}
+	v.Set("url", q.URL)
+	v.Set("output", "json")
+	if !q.From.IsZero() {
+		v.Set("from", q.From.UTC().Format(timestampLayout))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.UTC().Format(timestampLayout))
+	}
+	if q.MatchType != "" {
+		v.Set("matchType", string(q.MatchType))
+	}
+	for _, filter := range q.Filters {
+		v.Add("filter", filter)
+	}
+	for _, collapse := range q.Collapse {
+		v.Add("collapse", collapse)
+	}
+	if q.Limit != 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset != 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if len(q.Fields) > 0 {
+		v.Set("fl", strings.Join(q.Fields, ","))
+	}
+	if !q.Closest.IsZero() {
+		v.Set("closest", q.Closest.UTC().Format(timestampLayout))
+		v.Set("sort", "closest")
+	}
+	if q.ShowResumeKey {
+		v.Set("showResumeKey", "true")
+	}
+	if q.ResumeKey != "" {
+		v.Set("resumeKey", q.ResumeKey)
+	}
+	if q.PageSize > 0 {
+		v.Set("page", strconv.Itoa(q.Page))
+		v.Set("pageSize", strconv.Itoa(q.PageSize))
+	}
+	return v
+}
+
+// CDX runs a CDX query using the package-level default client settings.
+func CDX(q CDXQuery, timeout ...time.Duration) ([]CDXRecord, error) {
+	return defaultClient(timeout...).CDX(q)
+}
+
+// CDXContext is like CDX but aborts when ctx is done.
+func CDXContext(ctx context.Context, q CDXQuery, timeout ...time.Duration) ([]CDXRecord, error) {
+	return defaultClient(timeout...).CDXContext(ctx, q)
+}
+
+// CDX runs a query against the CDX server and returns the matching captures.
+func (c *Client) CDX(q CDXQuery) ([]CDXRecord, error) {
+	return c.CDXContext(context.Background(), q)
+}
+
+// CDXContext runs a query against the CDX server, aborting when ctx is done.
+//
+// Any resume key in the response is discarded; use CDXIterator to walk large
+// result sets.
+func (c *Client) CDXContext(ctx context.Context, q CDXQuery) ([]CDXRecord, error) {
+	records, _, err := c.cdxBatch(ctx, q)
+	return records, err
+}
+
+// cdxBatch runs a single CDX request and returns the records along with the
+// resume key, if any.
+func (c *Client) cdxBatch(ctx context.Context, q CDXQuery) ([]CDXRecord, string, error) {
+	if c.LocalIndex != nil {
+		return c.LocalIndex.Batch(q)
+	}
+
+	queryURL := fmt.Sprintf("%v/cdx/search/cdx?%v", c.BaseURL, q.Values().Encode())
+
+	rows := [][]string{}
+	if _, err := c.simpleHTTPJSON(ctx, queryURL, &rows); err != nil {
+		return nil, "", err
+	}
+
+	return parseCDXRows(rows)
+}
+
+// cdxNumPages asks the CDX server how many pages of q.PageSize blocks exist.
+func (c *Client) cdxNumPages(ctx context.Context, q CDXQuery) (int, error) {
+	if c.LocalIndex != nil {
+		return 1, nil
+	}
+
+	v := q.Values()
+	v.Del("page")
+	v.Set("showNumPages", "true")
+	queryURL := fmt.Sprintf("%v/cdx/search/cdx?%v", c.BaseURL, v.Encode())
+
+	var n int
+	if _, err := c.simpleHTTPJSON(ctx, queryURL, &n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// parseCDXRows converts CDX server JSON output, where the first row names the
+// fields, into records.  When showResumeKey was requested the output ends with
+// an empty row followed by a single-element row holding the resume key.
+func parseCDXRows(rows [][]string) ([]CDXRecord, string, error) {
+	var (
+		records   = []CDXRecord{}
+		resumeKey string
+	)
+
+	if n := len(rows); n >= 2 && len(rows[n-2]) == 0 && len(rows[n-1]) == 1 {
+		resumeKey = rows[n-1][0]
+		rows = rows[:n-2]
+	}
+
+	if len(rows) == 0 {
+		return records, resumeKey, nil
+	}
+
+	fields := rows[0]
+	for i, row := range rows[1:] {
+		record, err := newCDXRecord(fields, row)
+		if err != nil {
+			return nil, "", fmt.Errorf("parsing CDX row %v: %s", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, resumeKey, nil
+}
+
+// newCDXRecord builds a record from parallel field name and value slices.
+func newCDXRecord(fields []string, values []string) (CDXRecord, error) {
+	record := CDXRecord{}
+
+	if len(fields) != len(values) {
+		return record, fmt.Errorf("expected %v values but found %v", len(fields), len(values))
+	}
+
+	for i, field := range fields {
+		value := values[i]
+		switch field {
+		case "urlkey":
+			record.URLKey = value
+
+		case "timestamp":
+			ts, err := ParseTimestamp(value)
+			if err != nil {
+				return record, err
+			}
+			record.Timestamp = ts
+
+		case "original":
+			record.Original = value
+
+		case "mimetype":
+			record.MimeType = value
+
+		case "statuscode":
+			if value != "-" && value != "" {
+				sc, err := strconv.Atoi(value)
+				if err != nil {
+					return record, fmt.Errorf("parsing statuscode %q: %s", value, err)
+				}
+				record.StatusCode = sc
+			}
+
+		case "digest":
+			record.Digest = value
+
+		case "length":
+			if value != "-" && value != "" {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return record, fmt.Errorf("parsing length %q: %s", value, err)
+				}
+				record.Length = n
+			}
+
+		case "redirect":
+			if value != "-" {
+				record.Redirect = value
+			}
+
+		case "offset":
+			if value != "-" && value != "" {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return record, fmt.Errorf("parsing offset %q: %s", value, err)
+				}
+				record.Offset = n
+			}
+
+		case "filename":
+			if value != "-" {
+				record.Filename = value
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// ParseTimestamp parses a Wayback timestamp.  Truncated timestamps such as
+// "2015" or "20150601" are accepted and padded to the start of the period.
+func ParseTimestamp(s string) (time.Time, error) {
+	if len(s) < 4 || len(s) > len(timestampLayout) {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	if len(s) < len(timestampLayout) {
+		s += "0101000000"[len(s)-4:]
+	}
+	ts, err := time.Parse(timestampLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %s", s, err)
+	}
+	return ts, nil
+}
+
+// ParseTimestampRange parses a (possibly truncated) Wayback timestamp like
+// ParseTimestamp, also returning the last second of the period it covers,
+// e.g. the end of 2015 for "2015".
+func ParseTimestampRange(s string) (time.Time, time.Time, error) {
+	start, err := ParseTimestamp(s)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	var end time.Time
+	switch n := len(s); {
+	case n <= 4:
+		end = start.AddDate(1, 0, 0)
+	case n <= 6:
+		end = start.AddDate(0, 1, 0)
+	case n <= 8:
+		end = start.AddDate(0, 0, 1)
+	case n <= 10:
+		end = start.Add(time.Hour)
+	case n <= 12:
+		end = start.Add(time.Minute)
+	default:
+		end = start.Add(time.Second)
+	}
+	return start, end.Add(-time.Second), nil
+}
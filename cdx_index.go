@@ -0,0 +1,630 @@
+package archiveorg
+
+// Local CDX indexing of WARC/ARC files and an in-memory CDX index which
+// answers CDXQuery searches without contacting the CDX server.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalIndex, when set, is used by new clients in place of the CDX server.
+var LocalIndex *CDXIndex
+
+// cdxLegend maps CDX file header letters to CDX server field names.
+var cdxLegend = map[string]string{
+	"N": "urlkey",
+	"b": "timestamp",
+	"a": "original",
+	"m": "mimetype",
+	"s": "statuscode",
+	"k": "digest",
+	"r": "redirect",
+	"S": "length",
+	"V": "offset",
+	"g": "filename",
+}
+
+var (
+	cdx11Legend = strings.Fields("N b a m s k r M S V g")
+	cdx9Legend  = strings.Fields("N b a m s k r V g")
+)
+
+// SURT returns the Sort-friendly URI Reordering Transform of u as used for CDX
+// urlkey values, e.g. "com,jaytaylor)/docs?a=1&b=2" for
+// "https://www.JayTaylor.com/docs?b=2&a=1".
+func SURT(u string) string {
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(u)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	host = strings.TrimPrefix(host, "www.")
+	labels := strings.Split(host, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	key := strings.Join(labels, ",")
+	if port := parsed.Port(); port != "" && !(port == "80" && parsed.Scheme == "http") && !(port == "443" && parsed.Scheme == "https") {
+		key += ":" + port
+	}
+
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key += ")" + path
+	if parsed.RawQuery != "" {
+		params := strings.Split(parsed.RawQuery, "&")
+		sort.Strings(params)
+		key += "?" + strings.Join(params, "&")
+	}
+	return strings.ToLower(key)
+}
+
+// IndexWARC reads a WARC or ARC file and returns CDX records for its response,
+// revisit and resource records, sorted as in a CDX file.  filename is stored
+// in each record alongside the record's offset and length.
+func IndexWARC(r io.Reader, filename string) ([]CDXRecord, error) {
+	wr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []CDXRecord{}
+	for {
+		rec, err := wr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("indexing %v: %s", filename, err)
+		}
+		record, ok := indexWARCRecord(rec)
+		if !ok {
+			continue
+		}
+		record.Offset = wr.Offset()
+		record.Length = wr.Length()
+		record.Filename = filename
+		records = append(records, record)
+	}
+	sortCDXRecords(records)
+	return records, nil
+}
+
+// indexWARCRecord returns the CDX record for rec, or false when rec is not a
+// capture.
+func indexWARCRecord(rec *WARCRecord) (CDXRecord, bool) {
+	switch rec.Type {
+	case WARCResponse, WARCRevisit, WARCResource:
+	default:
+		return CDXRecord{}, false
+	}
+	if !strings.HasPrefix(rec.TargetURI, "http://") && !strings.HasPrefix(rec.TargetURI, "https://") {
+		// e.g. dns: records.
+		return CDXRecord{}, false
+	}
+
+	record := CDXRecord{
+		URLKey:    SURT(rec.TargetURI),
+		Timestamp: rec.Date.UTC(),
+		Original:  rec.TargetURI,
+	}
+	payload := rec.Block
+
+	if rec.Type == WARCResource {
+		record.MimeType = mediaType(rec.ContentType)
+		record.StatusCode = http.StatusOK
+	} else if resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil); err == nil {
+		record.StatusCode = resp.StatusCode
+		record.MimeType = mediaType(resp.Header.Get("Content-Type"))
+		if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			record.Redirect = location
+			if base, err := url.Parse(rec.TargetURI); err == nil {
+				if ref, err := base.Parse(location); err == nil {
+					record.Redirect = ref.String()
+				}
+			}
+		}
+		payload, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if rec.Type == WARCRevisit {
+		record.MimeType = "warc/revisit"
+	}
+	if record.MimeType == "" {
+		record.MimeType = "unk"
+	}
+
+	if digest := rec.Field("WARC-Payload-Digest"); digest != "" {
+		record.Digest = strings.TrimPrefix(digest, "sha1:")
+	} else {
+		record.Digest = strings.TrimPrefix(warcDigest(payload), "sha1:")
+	}
+	return record, true
+}
+
+// mediaType returns the lowercased media type of a Content-Type value,
+// without parameters.
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+}
+
+// WriteCDX writes records in the 11 field CDX format, preceded by its legend
+// line.
+func WriteCDX(w io.Writer, records []CDXRecord) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, " CDX %v\n", strings.Join(cdx11Legend, " "))
+	for _, record := range records {
+		values := make([]string, len(cdx11Legend))
+		for i, letter := range cdx11Legend {
+			values[i] = "-"
+			if field, ok := cdxLegend[letter]; ok {
+				if value := record.Field(field); value != "" {
+					values[i] = value
+				}
+			}
+		}
+		fmt.Fprintln(bw, strings.Join(values, " "))
+	}
+	return bw.Flush()
+}
+
+// WriteCDXJ writes records as "urlkey timestamp {json}" CDXJ lines, as used by
+// pywb and the timemap/cdxj endpoint.
+func WriteCDXJ(w io.Writer, records []CDXRecord) error {
+	type cdxjFields struct {
+		URL      string `json:"url"`
+		Mime     string `json:"mime,omitempty"`
+		Status   string `json:"status,omitempty"`
+		Digest   string `json:"digest,omitempty"`
+		Length   string `json:"length,omitempty"`
+		Offset   string `json:"offset,omitempty"`
+		Filename string `json:"filename,omitempty"`
+		Redirect string `json:"redirect,omitempty"`
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for _, record := range records {
+		fields := cdxjFields{
+			URL:      record.Original,
+			Mime:     record.MimeType,
+			Digest:   record.Digest,
+			Filename: record.Filename,
+			Redirect: record.Redirect,
+		}
+		if record.StatusCode != 0 {
+			fields.Status = strconv.Itoa(record.StatusCode)
+		}
+		if record.Length != 0 {
+			fields.Length = strconv.FormatInt(record.Length, 10)
+		}
+		if record.Filename != "" {
+			fields.Offset = strconv.FormatInt(record.Offset, 10)
+		}
+		fmt.Fprintf(bw, "%v %v ", record.Field("urlkey"), record.Field("timestamp"))
+		if err := enc.Encode(fields); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Field returns the CDX server representation of the named field, e.g.
+// "timestamp" or "statuscode", or "" when it is unset.
+func (record CDXRecord) Field(field string) string {
+	switch field {
+	case "urlkey":
+		if record.URLKey == "" && record.Original != "" {
+			return SURT(record.Original)
+		}
+		return record.URLKey
+	case "timestamp":
+		if record.Timestamp.IsZero() {
+			return ""
+		}
+		return record.Timestamp.UTC().Format(timestampLayout)
+	case "original":
+		return record.Original
+	case "mimetype":
+		return record.MimeType
+	case "statuscode":
+		if record.StatusCode == 0 {
+			return ""
+		}
+		return strconv.Itoa(record.StatusCode)
+	case "digest":
+		return record.Digest
+	case "length":
+		if record.Length == 0 {
+			return ""
+		}
+		return strconv.FormatInt(record.Length, 10)
+	case "offset":
+		if record.Filename == "" {
+			return ""
+		}
+		return strconv.FormatInt(record.Offset, 10)
+	case "filename":
+		return record.Filename
+	case "redirect":
+		return record.Redirect
+	}
+	return ""
+}
+
+// CDXIndex is an in-memory CDX index which answers CDXQuery searches the way
+// the CDX server does, e.g. for offline use with Client.LocalIndex.
+type CDXIndex struct {
+	records []CDXRecord // Sorted by urlkey, then timestamp.
+}
+
+// NewCDXIndex returns an index of records.
+func NewCDXIndex(records ...CDXRecord) *CDXIndex {
+	idx := &CDXIndex{}
+	idx.Add(records...)
+	return idx
+}
+
+// Add inserts records into the index.
+func (idx *CDXIndex) Add(records ...CDXRecord) {
+	for _, record := range records {
+		if record.URLKey == "" {
+			record.URLKey = SURT(record.Original)
+		}
+		idx.records = append(idx.records, record)
+	}
+	sortCDXRecords(idx.records)
+}
+
+// Records returns all records in index order.
+func (idx *CDXIndex) Records() []CDXRecord {
+	return append([]CDXRecord(nil), idx.records...)
+}
+
+// LoadCDXIndex reads a CDX file (with or without a " CDX" legend line) or a
+// CDXJ file into a new index.
+func LoadCDXIndex(r io.Reader) (*CDXIndex, error) {
+	var (
+		records = []CDXRecord{}
+		legend  []string
+		scanner = bufio.NewScanner(r)
+		i       int
+	)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.HasPrefix(line, "CDX ") {
+			legend = strings.Fields(line)[1:]
+			continue
+		}
+
+		var (
+			record CDXRecord
+			err    error
+		)
+		if pieces := strings.SplitN(line, " ", 3); len(pieces) == 3 && strings.HasPrefix(pieces[2], "{") {
+			record, err = parseCDXJLine(line)
+		} else {
+			record, err = parseCDXLine(line, legend)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing CDX line %v: %s", i, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewCDXIndex(records...), nil
+}
+
+// parseCDXLine parses a space separated CDX line, defaulting to the 11 or 9
+// field legends when the file has none.
+func parseCDXLine(line string, legend []string) (CDXRecord, error) {
+	values := strings.Fields(line)
+	if legend == nil {
+		switch len(values) {
+		case len(cdx11Legend):
+			legend = cdx11Legend
+		case len(cdx9Legend):
+			legend = cdx9Legend
+		default:
+			return CDXRecord{}, fmt.Errorf("unrecognized CDX line with %v fields", len(values))
+		}
+	}
+	fields := make([]string, len(legend))
+	for i, letter := range legend {
+		fields[i] = cdxLegend[letter]
+	}
+	return newCDXRecord(fields, values)
+}
+
+// Search returns the records matching q.  Paged queries are answered as a
+// single page.
+func (idx *CDXIndex) Search(q CDXQuery) ([]CDXRecord, error) {
+	records, _, err := idx.Batch(q)
+	return records, err
+}
+
+// Batch is like Search and also returns the resume key when q.ShowResumeKey
+// is set and the results were truncated by q.Limit.  Resume keys are
+// positions in the filtered results.
+func (idx *CDXIndex) Batch(q CDXQuery) ([]CDXRecord, string, error) {
+	if q.PageSize > 0 && q.Page > 0 {
+		return []CDXRecord{}, "", nil
+	}
+
+	filters, err := newCDXFilters(q.Filters)
+	if err != nil {
+		return nil, "", err
+	}
+	collapsers, err := newCDXCollapsers(q.Collapse)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		matches = []CDXRecord{}
+		match   = cdxURLMatcher(q)
+		prefix  = match.prefix
+		start   = sort.Search(len(idx.records), func(i int) bool { return idx.records[i].URLKey >= prefix })
+	)
+	for _, record := range idx.records[start:] {
+		if !strings.HasPrefix(record.URLKey, prefix) {
+			break
+		}
+		if !match.matches(record.URLKey) {
+			continue
+		}
+		if !q.From.IsZero() && record.Timestamp.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && record.Timestamp.After(q.To) {
+			continue
+		}
+		if !filters.matches(record) {
+			continue
+		}
+		if len(matches) > 0 && collapsers.collapses(matches[len(matches)-1], record) {
+			continue
+		}
+		matches = append(matches, record)
+	}
+	if !q.Closest.IsZero() {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return absDuration(matches[i].Timestamp.Sub(q.Closest)) < absDuration(matches[j].Timestamp.Sub(q.Closest))
+		})
+	}
+
+	offset := q.Offset
+	if q.ResumeKey != "" {
+		if offset, err = strconv.Atoi(q.ResumeKey); err != nil || offset < 0 {
+			return nil, "", fmt.Errorf("invalid resume key %q", q.ResumeKey)
+		}
+	}
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+
+	var resumeKey string
+	switch {
+	case q.Limit > 0 && q.Limit < len(matches):
+		matches = matches[:q.Limit]
+		if q.ShowResumeKey {
+			resumeKey = strconv.Itoa(offset + q.Limit)
+		}
+	case q.Limit < 0 && -q.Limit < len(matches):
+		matches = matches[len(matches)+q.Limit:]
+	}
+
+	if len(q.Fields) > 0 {
+		for i := range matches {
+			matches[i] = selectCDXFields(matches[i], q.Fields)
+		}
+	}
+	return matches, resumeKey, nil
+}
+
+// cdxURLMatch matches urlkeys for a query.  All matching urlkeys start with
+// prefix.
+type cdxURLMatch struct {
+	prefix  string
+	matches func(urlKey string) bool
+}
+
+// cdxURLMatcher applies q.MatchType, honoring the CDX server's "url*" and
+// "*.domain" wildcard shorthands.
+func cdxURLMatcher(q CDXQuery) cdxURLMatch {
+	var (
+		u         = q.URL
+		matchType = q.MatchType
+	)
+	if strings.HasPrefix(u, "*.") {
+		u, matchType = u[2:], MatchDomain
+	} else if strings.HasSuffix(u, "*") {
+		u, matchType = strings.TrimSuffix(u, "*"), MatchPrefix
+	}
+
+	key := SURT(u)
+	host := key
+	if i := strings.Index(key, ")"); i >= 0 {
+		host = key[:i]
+	}
+
+	switch matchType {
+	case MatchPrefix:
+		return cdxURLMatch{key, func(string) bool { return true }}
+	case MatchHost:
+		return cdxURLMatch{host + ")", func(string) bool { return true }}
+	case MatchDomain:
+		return cdxURLMatch{host, func(urlKey string) bool {
+			next := urlKey[len(host):]
+			return strings.HasPrefix(next, ")") || strings.HasPrefix(next, ",") || strings.HasPrefix(next, ":")
+		}}
+	default:
+		return cdxURLMatch{key, func(urlKey string) bool { return urlKey == key }}
+	}
+}
+
+type cdxFilter struct {
+	field  string
+	expr   *regexp.Regexp
+	negate bool
+}
+
+type cdxFilters []cdxFilter
+
+// newCDXFilters parses "[!]field:regex" filters.  As on the CDX server the
+// expression must match the whole value; a leading "~" instead matches a
+// substring.
+func newCDXFilters(specs []string) (cdxFilters, error) {
+	filters := cdxFilters{}
+	for _, spec := range specs {
+		filter := cdxFilter{}
+		s := spec
+		if strings.HasPrefix(s, "!") {
+			filter.negate = true
+			s = s[1:]
+		}
+		contains := strings.HasPrefix(s, "~")
+		s = strings.TrimPrefix(s, "~")
+
+		pieces := strings.SplitN(s, ":", 2)
+		if len(pieces) != 2 || pieces[0] == "" {
+			return nil, fmt.Errorf("invalid filter %q", spec)
+		}
+		filter.field = pieces[0]
+		expr := regexp.QuoteMeta(pieces[1])
+		if !contains {
+			expr = "^(?:" + pieces[1] + ")$"
+		}
+		var err error
+		if filter.expr, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %s", spec, err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+func (filters cdxFilters) matches(record CDXRecord) bool {
+	for _, filter := range filters {
+		value := record.Field(filter.field)
+		if value == "" {
+			value = "-"
+		}
+		if filter.expr.MatchString(value) == filter.negate {
+			return false
+		}
+	}
+	return true
+}
+
+type cdxCollapser struct {
+	field string
+	n     int // Compare only the first n characters when > 0.
+}
+
+type cdxCollapsers []cdxCollapser
+
+// newCDXCollapsers parses "field" or "field:N" collapse specifications.
+func newCDXCollapsers(specs []string) (cdxCollapsers, error) {
+	collapsers := cdxCollapsers{}
+	for _, spec := range specs {
+		pieces := strings.SplitN(spec, ":", 2)
+		collapser := cdxCollapser{field: pieces[0]}
+		if len(pieces) == 2 {
+			n, err := strconv.Atoi(pieces[1])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid collapse %q", spec)
+			}
+			collapser.n = n
+		}
+		collapsers = append(collapsers, collapser)
+	}
+	return collapsers, nil
+}
+
+// collapses reports whether record duplicates prev, the last record kept.
+func (collapsers cdxCollapsers) collapses(prev CDXRecord, record CDXRecord) bool {
+	for _, collapser := range collapsers {
+		a, b := prev.Field(collapser.field), record.Field(collapser.field)
+		if collapser.n > 0 {
+			if len(a) > collapser.n {
+				a = a[:collapser.n]
+			}
+			if len(b) > collapser.n {
+				b = b[:collapser.n]
+			}
+		}
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// selectCDXFields returns a copy of record with only the named fields set.
+func selectCDXFields(record CDXRecord, fields []string) CDXRecord {
+	selected := CDXRecord{}
+	for _, field := range fields {
+		switch field {
+		case "urlkey":
+			selected.URLKey = record.URLKey
+		case "timestamp":
+			selected.Timestamp = record.Timestamp
+		case "original":
+			selected.Original = record.Original
+		case "mimetype":
+			selected.MimeType = record.MimeType
+		case "statuscode":
+			selected.StatusCode = record.StatusCode
+		case "digest":
+			selected.Digest = record.Digest
+		case "length":
+			selected.Length = record.Length
+		case "redirect":
+			selected.Redirect = record.Redirect
+		case "offset":
+			selected.Offset = record.Offset
+		case "filename":
+			selected.Filename = record.Filename
+		}
+	}
+	return selected
+}
+
+// sortCDXRecords sorts records by urlkey, then timestamp.
+func sortCDXRecords(records []CDXRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].URLKey != records[j].URLKey {
+			return records[i].URLKey < records[j].URLKey
+		}
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+}
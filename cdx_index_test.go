@@ -0,0 +1,203 @@
+package archiveorg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSURT(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.JayTaylor.com/docs?b=2&a=1", "com,jaytaylor)/docs?a=1&b=2"},
+		{"jaytaylor.com", "com,jaytaylor)/"},
+		{"http://jaytaylor.com:80/", "com,jaytaylor)/"},
+		{"http://blog.jaytaylor.com:8080/a#frag", "com,jaytaylor,blog:8080)/a"},
+	}
+	for i, testCase := range testCases {
+		if actual := SURT(testCase.url); actual != testCase.expected {
+			t.Errorf("[i=%v] Expected %v but actual=%v", i, testCase.expected, actual)
+		}
+	}
+}
+
+func TestIndexWARC(t *testing.T) {
+	var (
+		buf bytes.Buffer
+		ww  = NewWARCWriter(&buf, true)
+	)
+	if err := ww.WriteWarcinfo("test.warc.gz"); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []*WARCRecord{
+		{
+			Type:        WARCResponse,
+			Date:        time.Date(2018, 3, 26, 7, 3, 30, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/old",
+			ContentType: "application/http;msgtype=response",
+			Block:       []byte("HTTP/1.1 301 Moved Permanently\r\nLocation: /new\r\nContent-Length: 0\r\n\r\n"),
+		},
+		{
+			Type:        WARCResponse,
+			Date:        time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: 5\r\n\r\nhello"),
+		},
+		{
+			Type:      WARCMetadata,
+			TargetURI: "https://jaytaylor.com/",
+			Block:     []byte("via: x\r\n"),
+		},
+	} {
+		if err := ww.WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := IndexWARC(bytes.NewReader(buf.Bytes()), "test.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(records); actual != expected {
+		t.Fatalf("Expected %v records but actual=%v", expected, actual)
+	}
+
+	home, old := records[0], records[1]
+	if home.URLKey != "com,jaytaylor)/" || home.StatusCode != 200 || home.MimeType != "text/html" || "sha1:"+home.Digest != warcDigest([]byte("hello")) || home.Filename != "test.warc.gz" {
+		t.Errorf("Unexpected record: %+v", home)
+	}
+	if old.URLKey != "com,jaytaylor)/old" || old.StatusCode != 301 || old.Redirect != "https://jaytaylor.com/new" {
+		t.Errorf("Unexpected record: %+v", old)
+	}
+
+	// The offset and length locate the record in the file.
+	wr, err := NewWARCReader(bytes.NewReader(buf.Bytes()[home.Offset : home.Offset+home.Length]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := wr.Next(); err != nil || rec.TargetURI != home.Original {
+		t.Errorf("Expected to read %v at offset %v, err=%v", home.Original, home.Offset, err)
+	}
+
+	// Both output formats load back into an equivalent index.
+	for _, write := range []func(*bytes.Buffer) error{
+		func(b *bytes.Buffer) error { return WriteCDX(b, records) },
+		func(b *bytes.Buffer) error { return WriteCDXJ(b, records) },
+	} {
+		var out bytes.Buffer
+		if err := write(&out); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := LoadCDXIndex(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := idx.Search(CDXQuery{URL: "jaytaylor.com", MatchType: MatchHost})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != len(records) {
+			t.Fatalf("Expected %v records but actual=%v", len(records), len(loaded))
+		}
+		for i := range records {
+			if loaded[i] != records[i] {
+				t.Errorf("[i=%v] Expected %+v but actual=%+v", i, records[i], loaded[i])
+			}
+		}
+	}
+}
+
+func TestCDXIndexSearch(t *testing.T) {
+	const cdx = ` CDX N b a m s k r M S V g
+com,jaytaylor)/ 20170101000000 https://jaytaylor.com/ text/html 200 AAA - - 100 0 a.warc.gz
+com,jaytaylor)/ 20170601000000 https://jaytaylor.com/ text/html 200 AAA - - 100 100 a.warc.gz
+com,jaytaylor)/ 20180101000000 https://jaytaylor.com/ text/html 200 BBB - - 100 200 a.warc.gz
+com,jaytaylor)/docs 20180101000000 https://jaytaylor.com/docs text/html 404 CCC - - 100 300 a.warc.gz
+com,jaytaylor,blog)/ 20180101000000 https://blog.jaytaylor.com/ text/html 200 DDD - - 100 400 a.warc.gz
+com,other)/ 20180101000000 https://other.com/ text/html 200 EEE - - 100 500 a.warc.gz
+`
+	idx, err := LoadCDXIndex(strings.NewReader(cdx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		query    CDXQuery
+		expected []int64 // Offsets.
+	}{
+		{CDXQuery{URL: "jaytaylor.com"}, []int64{0, 100, 200}},
+		{CDXQuery{URL: "jaytaylor.com", MatchType: MatchPrefix}, []int64{0, 100, 200, 300}},
+		{CDXQuery{URL: "jaytaylor.com", MatchType: MatchDomain}, []int64{0, 100, 200, 300, 400}},
+		{CDXQuery{URL: "*.jaytaylor.com"}, []int64{0, 100, 200, 300, 400}},
+		{CDXQuery{URL: "jaytaylor.com", From: time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2017, 12, 31, 0, 0, 0, 0, time.UTC)}, []int64{100}},
+		{CDXQuery{URL: "jaytaylor.com", MatchType: MatchPrefix, Filters: []string{"!statuscode:200"}}, []int64{300}},
+		{CDXQuery{URL: "jaytaylor.com", MatchType: MatchPrefix, Filters: []string{"~original:docs"}}, []int64{300}},
+		{CDXQuery{URL: "jaytaylor.com", Collapse: []string{"digest"}}, []int64{0, 200}},
+		{CDXQuery{URL: "jaytaylor.com", Collapse: []string{"timestamp:4"}}, []int64{0, 200}},
+		{CDXQuery{URL: "jaytaylor.com", Limit: -1}, []int64{200}},
+		{CDXQuery{URL: "jaytaylor.com", Offset: 1, Limit: 1}, []int64{100}},
+		{CDXQuery{URL: "jaytaylor.com", Closest: time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC), Limit: 2}, []int64{100, 0}},
+	}
+	for i, testCase := range testCases {
+		records, err := idx.Search(testCase.query)
+		if err != nil {
+			t.Fatalf("[i=%v] %s", i, err)
+		}
+		offsets := []int64{}
+		for _, record := range records {
+			offsets = append(offsets, record.Offset)
+		}
+		if len(offsets) != len(testCase.expected) {
+			t.Errorf("[i=%v] Expected offsets=%v but actual=%v", i, testCase.expected, offsets)
+			continue
+		}
+		for j := range offsets {
+			if offsets[j] != testCase.expected[j] {
+				t.Errorf("[i=%v] Expected offsets=%v but actual=%v", i, testCase.expected, offsets)
+				break
+			}
+		}
+	}
+
+	// Clients with a local index resume through it and never touch the network.
+	c := NewClient()
+	c.BaseURL = "http://127.0.0.1:0"
+	c.LocalIndex = idx
+
+	var n int
+	it := c.CDXIterator(context.Background(), CDXQuery{URL: "jaytaylor.com", MatchType: MatchDomain, Limit: 2})
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 5, n; actual != expected {
+		t.Errorf("Expected %v records but actual=%v", expected, actual)
+	}
+
+	snaps, err := c.Search("jaytaylor.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 3 || snaps[0].URL != "http://127.0.0.1:0/web/20180101000000/https://jaytaylor.com/" {
+		t.Errorf("Unexpected snapshots: %+v", snaps)
+	}
+
+	snap, err := c.Closest("jaytaylor.com", time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "http://127.0.0.1:0/web/20170601000000/https://jaytaylor.com/", snap.URL; actual != expected {
+		t.Errorf("Expected closest=%v but actual=%v", expected, actual)
+	}
+	if _, err := c.Closest("jaytaylor.com/docs", time.Now()); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Expected ErrNotArchived for a URL with only a 404 capture but actual=%v", err)
+	}
+}
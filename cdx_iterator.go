@@ -0,0 +1,125 @@
+package archiveorg
+
+import (
+	"context"
+)
+
+// DefaultCDXBatchSize is the number of records requested per round-trip by
+// CDXIterator when the query does not set a Limit.
+var DefaultCDXBatchSize = 1000
+
+// CDXIterator walks a CDX result set one record at a time, fetching further
+// batches on demand so memory use stays flat regardless of the result size.
+//
+// When the query sets PageSize the iterator follows page= pagination,
+// otherwise it follows showResumeKey/resumeKey pagination using the query
+// Limit (or DefaultCDXBatchSize) as the batch size.
+//
+// Usage:
+//
+//	it := client.CDXIterator(ctx, archiveorg.CDXQuery{URL: "jaytaylor.com", MatchType: archiveorg.MatchDomain})
+//	for it.Next() {
+//		record := it.Record()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type CDXIterator struct {
+	client   *Client
+	ctx      context.Context
+	query    CDXQuery
+	buf      []CDXRecord
+	record   CDXRecord
+	numPages int // -1 until known.
+	done     bool
+	err      error
+}
+
+// CDXIterator returns an iterator over all results of q.
+func (c *Client) CDXIterator(ctx context.Context, q CDXQuery) *CDXIterator {
+	if q.PageSize > 0 {
+		q.ShowResumeKey = false
+		q.ResumeKey = ""
+	} else {
+		q.ShowResumeKey = true
+		if q.Limit <= 0 {
+			q.Limit = DefaultCDXBatchSize
+		}
+	}
+
+	it := &CDXIterator{
+		client:   c,
+		ctx:      ctx,
+		query:    q,
+		numPages: -1,
+	}
+	return it
+}
+
+// Next advances to the next record, fetching another batch when necessary.  It
+// returns false once the results are exhausted or an error occurs.
+func (it *CDXIterator) Next() bool {
+	for len(it.buf) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+	}
+
+	it.record = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+// Record returns the current record.
+func (it *CDXIterator) Record() CDXRecord {
+	return it.record
+}
+
+// Err returns the first error encountered, if any.
+func (it *CDXIterator) Err() error {
+	return it.err
+}
+
+func (it *CDXIterator) fetch() error {
+	if it.query.PageSize > 0 {
+		return it.fetchPage()
+	}
+
+	records, resumeKey, err := it.client.cdxBatch(it.ctx, it.query)
+	if err != nil {
+		return err
+	}
+	it.buf = records
+	if resumeKey == "" {
+		it.done = true
+	}
+	it.query.ResumeKey = resumeKey
+	return nil
+}
+
+func (it *CDXIterator) fetchPage() error {
+	if it.numPages < 0 {
+		n, err := it.client.cdxNumPages(it.ctx, it.query)
+		if err != nil {
+			return err
+		}
+		it.numPages = n
+	}
+
+	if it.query.Page >= it.numPages {
+		it.done = true
+		return nil
+	}
+
+	records, _, err := it.client.cdxBatch(it.ctx, it.query)
+	if err != nil {
+		return err
+	}
+	it.buf = records
+	it.query.Page++
+	return nil
+}
@@ -0,0 +1,75 @@
+package archiveorg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCDXIteratorResumeKey(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if expected, actual := "true", q.Get("showResumeKey"); actual != expected {
+			t.Errorf("Expected showResumeKey=%v but actual=%v", expected, actual)
+		}
+		header := `[["timestamp","original"],`
+		switch q.Get("resumeKey") {
+		case "":
+			fmt.Fprint(w, header+`["20010331114839","http://jaytaylor.com/"],["20010405072207","http://jaytaylor.com/"],[],["key1"]]`)
+		case "key1":
+			fmt.Fprint(w, header+`["20011128153904","http://jaytaylor.com/"],[],["key2"]]`)
+		case "key2":
+			fmt.Fprint(w, header+`["20020118040828","http://jaytaylor.com/"]]`)
+		default:
+			t.Errorf("Unexpected resumeKey=%v", q.Get("resumeKey"))
+		}
+	}))
+
+	it := c.CDXIterator(context.Background(), CDXQuery{URL: "jaytaylor.com", Limit: 2})
+	n := 0
+	for it.Next() {
+		if it.Record().Original != "http://jaytaylor.com/" {
+			t.Errorf("[n=%v] Unexpected record: %+v", n, it.Record())
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, n; actual != expected {
+		t.Errorf("Expected num records=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestCDXIteratorPages(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("showNumPages") == "true" {
+			fmt.Fprint(w, "3\n")
+			return
+		}
+		switch q.Get("page") {
+		case "0":
+			fmt.Fprint(w, `[["timestamp"],["20010331114839"],["20010405072207"]]`)
+		case "1":
+			fmt.Fprint(w, `[]`)
+		case "2":
+			fmt.Fprint(w, `[["timestamp"],["20011128153904"]]`)
+		default:
+			t.Errorf("Unexpected page=%v", q.Get("page"))
+		}
+	}))
+
+	it := c.CDXIterator(context.Background(), CDXQuery{URL: "jaytaylor.com", PageSize: 1})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 3, n; actual != expected {
+		t.Errorf("Expected num records=%v but actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,108 @@
+package archiveorg
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCDX(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "/cdx/search/cdx", r.URL.Path; actual != expected {
+			t.Errorf("Expected path=%v but actual=%v", expected, actual)
+		}
+		q := r.URL.Query()
+		for param, expected := range map[string]string{
+			"url":       "jaytaylor.com",
+			"matchType": "prefix",
+			"from":      "20150101000000",
+			"limit":     "2",
+			"collapse":  "digest",
+		} {
+			if actual := q.Get(param); actual != expected {
+				t.Errorf("Expected param %v=%q but actual=%q", param, expected, actual)
+			}
+		}
+		if expected, actual := 2, len(q["filter"]); actual != expected {
+			t.Errorf("Expected %v filter params but actual=%v", expected, actual)
+		}
+		fmt.Fprint(w, rawCDXJSON)
+	}))
+
+	records, err := c.CDX(CDXQuery{
+		URL:       "jaytaylor.com",
+		MatchType: MatchPrefix,
+		From:      time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+		Filters:   []string{"statuscode:200", "!mimetype:image/png"},
+		Collapse:  []string{"digest"},
+		Limit:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := 2, len(records); actual != expected {
+		t.Fatalf("Expected num records=%v but actual=%v", expected, actual)
+	}
+
+	expected := CDXRecord{
+		URLKey:     "com,jaytaylor)/",
+		Timestamp:  time.Date(2015, 1, 12, 12, 11, 49, 0, time.UTC),
+		Original:   "http://jaytaylor.com:80/",
+		MimeType:   "text/html",
+		StatusCode: 200,
+		Digest:     "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY",
+		Length:     3520,
+	}
+	if actual := records[0]; actual != expected {
+		t.Errorf("Expected records[0]=%+v but actual=%+v", expected, actual)
+	}
+	if actual := records[1].StatusCode; actual != 0 {
+		t.Errorf("Expected records[1].StatusCode=0 for \"-\" but actual=%v", actual)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	testCases := map[string]time.Time{
+		"2015":           time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+		"201506":         time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC),
+		"20150612":       time.Date(2015, 6, 12, 0, 0, 0, 0, time.UTC),
+		"20150612101112": time.Date(2015, 6, 12, 10, 11, 12, 0, time.UTC),
+	}
+	for input, expected := range testCases {
+		actual, err := ParseTimestamp(input)
+		if err != nil {
+			t.Errorf("[input=%v] Unexpected error: %s", input, err)
+			continue
+		}
+		if !actual.Equal(expected) {
+			t.Errorf("[input=%v] Expected=%v but actual=%v", input, expected, actual)
+		}
+	}
+}
+
+func TestParseTimestampRange(t *testing.T) {
+	testCases := map[string][2]time.Time{
+		"2016":           {time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 12, 31, 23, 59, 59, 0, time.UTC)},
+		"201602":         {time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, 2, 29, 23, 59, 59, 0, time.UTC)},
+		"2016021":        {time.Date(2016, 2, 11, 0, 0, 0, 0, time.UTC), time.Date(2016, 2, 11, 23, 59, 59, 0, time.UTC)},
+		"2016021510":     {time.Date(2016, 2, 15, 10, 0, 0, 0, time.UTC), time.Date(2016, 2, 15, 10, 59, 59, 0, time.UTC)},
+		"20160215101112": {time.Date(2016, 2, 15, 10, 11, 12, 0, time.UTC), time.Date(2016, 2, 15, 10, 11, 12, 0, time.UTC)},
+	}
+	for input, expected := range testCases {
+		start, end, err := ParseTimestampRange(input)
+		if err != nil {
+			t.Errorf("[input=%v] Unexpected error: %s", input, err)
+			continue
+		}
+		if !start.Equal(expected[0]) || !end.Equal(expected[1]) {
+			t.Errorf("[input=%v] Expected=%v - %v but actual=%v - %v", input, expected[0], expected[1], start, end)
+		}
+	}
+}
+
+const rawCDXJSON = `[["urlkey","timestamp","original","mimetype","statuscode","digest","length"],
+["com,jaytaylor)/", "20150112121149", "http://jaytaylor.com:80/", "text/html", "200", "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY", "3520"],
+["com,jaytaylor)/", "20150206012931", "http://jaytaylor.com:80/", "warc/revisit", "-", "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY", "612"]]
+`
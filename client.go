@@ -0,0 +1,67 @@
+package archiveorg
+
+import (
+	"net/http"
+	"time"
+)
+
+// Client carries its own Wayback Machine endpoint configuration, making it
+// safe to talk to several archive.org-compatible servers concurrently.
+//
+// The zero value is not usable; construct with NewClient.
+type Client struct {
+	BaseURL        string        // e.g. "https://web.archive.org".
+	HTTPHost       string        // Value for the 'Host' header.
+	UserAgent      string        // Value for the 'User-Agent' header.
+	AccessKey      string        // archive.org S3-style access key; when set, Capture uses Save Page Now 2.
+	SecretKey      string        // archive.org S3-style secret key.
+	Header         http.Header   // Additional headers to set on every request.
+	RequestTimeout time.Duration // Per-request timeout.
+	MaxTries       int           // Max number of download retries before giving up, 0 disables retries.
+	RetryPolicy    RetryPolicy   // Which failures are retried and how long to wait; nil uses NewRetryPolicy.
+	TimeMapFormat  TimeMapFormat // Format requested by TimeMap; defaults to TimeMapLinkFormat.
+	HTTPClient     *http.Client  // Underlying HTTP client; when nil, one is built from RequestTimeout.
+
+	RateLimits map[EndpointClass]*RateLimiter // Per endpoint class request rate limits, shared with copies of the client.
+	LocalIndex *CDXIndex                      // When set, CDX queries and Search are answered from this index instead of archive.org.
+}
+
+// NewClient returns a Client initialized from the current package-level
+// default values.
+func NewClient() *Client {
+	c := &Client{
+		BaseURL:        BaseURL,
+		HTTPHost:       HTTPHost,
+		UserAgent:      UserAgent,
+		AccessKey:      AccessKey,
+		SecretKey:      SecretKey,
+		Header:         http.Header{},
+		RequestTimeout: DefaultRequestTimeout,
+		MaxTries:       MaxTries,
+		RetryPolicy:    NewRetryPolicy(),
+		RateLimits:     map[EndpointClass]*RateLimiter{},
+		LocalIndex:     LocalIndex,
+	}
+	for class, limiter := range RateLimits {
+		c.RateLimits[class] = limiter
+	}
+	return c
+}
+
+// defaultClient returns a client reflecting the package-level defaults, used
+// by the top-level convenience functions.  An optional timeout overrides
+// DefaultRequestTimeout.
+func defaultClient(timeout ...time.Duration) *Client {
+	c := NewClient()
+	if len(timeout) > 0 {
+		c.RequestTimeout = timeout[0]
+	}
+	return c
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return newClient(c.RequestTimeout)
+}
@@ -0,0 +1,49 @@
+package archiveorg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient starts a test server for handler and returns a client pointed
+// at it, whose BaseURL is the server's URL.  The server is closed when the test
+// finishes.
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c := NewClient()
+	c.BaseURL = ts.URL
+	c.HTTPHost = ""
+	return c
+}
+
+func TestClientNewRequest(t *testing.T) {
+	c := NewClient()
+	c.BaseURL = "http://localhost:8080"
+	c.HTTPHost = ""
+	c.UserAgent = "archiveorg-test"
+	c.Header.Set("X-Extra", "1")
+
+	req, err := c.newRequest(context.Background(), "", c.BaseURL+"/web/timemap/link/https://jaytaylor.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := "localhost:8080", req.Header.Get("Origin"); actual != expected {
+		t.Errorf("Expected Origin header=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "archiveorg-test", req.Header.Get("User-Agent"); actual != expected {
+		t.Errorf("Expected User-Agent header=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := "1", req.Header.Get("X-Extra"); actual != expected {
+		t.Errorf("Expected X-Extra header=%q but actual=%q", expected, actual)
+	}
+
+	// Package defaults must not have been affected.
+	if BaseURL == c.BaseURL {
+		t.Errorf("Expected package BaseURL to be unchanged but it was %q", BaseURL)
+	}
+}
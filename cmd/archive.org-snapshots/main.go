@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"jaytaylor.com/archive.org"
+	"jaytaylor.com/archive.org/server"
 )
 
 var (
@@ -16,6 +23,23 @@ var (
 	Verbose        bool
 	Wait           bool
 	RequestTimeout time.Duration = archiveorg.DefaultRequestTimeout
+	At             string
+	Rate           string
+	Modifier       string = string(archiveorg.ModifierIdentity)
+	Output         string
+	ShowHeaders    bool
+	Unrewrite      bool
+	From           string
+	To             string
+	MatchType      string = string(archiveorg.MatchExact)
+	Filters        []string
+	Limit          int
+	Gzip           bool
+	IndexFile      string
+	CDXJ           bool
+	Listen         string = "localhost:8080"
+	WARCDir        string = "."
+	MirrorOptions         = archiveorg.MirrorOptions{Dir: ".", Depth: 1, Scope: archiveorg.MatchPrefix, Window: 30 * 24 * time.Hour, Concurrency: 2}
 )
 
 func init() {
@@ -25,6 +49,43 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.BaseURL, "base-url", "b", archiveorg.BaseURL, "Archive.org server base URL address")
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.HTTPHost, "http-host", "", archiveorg.HTTPHost, "'Host' header to use")
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.UserAgent, "user-agent", "u", archiveorg.UserAgent, "'User-Agent' header to use")
+	rootCmd.PersistentFlags().StringVarP(&Rate, "rate", "", "", "Max request rate, e.g. \"1/s\" or \"30/m\" (default unlimited)")
+	rootCmd.PersistentFlags().StringVarP(&IndexFile, "index", "", "", "Answer searches and closest capture lookups from this local CDX or CDXJ file instead of archive.org")
+
+	closestCmd.Flags().StringVarP(&At, "at", "", "", "Target time as YYYY-MM-DD, RFC3339 or a Wayback timestamp (default now)")
+	rootCmd.AddCommand(closestCmd)
+
+	fetchCmd.Flags().StringVarP(&At, "at", "", "", "Target time as YYYY-MM-DD, RFC3339 or a Wayback timestamp (default now)")
+	fetchCmd.Flags().StringVarP(&Modifier, "modifier", "m", Modifier, "Wayback URL modifier: id_ (original bytes), js_, cs_, im_, if_, oe_ or \"\" for the rewritten page")
+	fetchCmd.Flags().StringVarP(&Output, "output", "o", "", "Write the body to this file instead of stdout")
+	fetchCmd.Flags().BoolVarP(&ShowHeaders, "headers", "", false, "Print the original response headers to stderr")
+	fetchCmd.Flags().BoolVarP(&Unrewrite, "unrewrite", "", false, "Strip the Wayback toolbar and restore original URLs in the replayed content")
+	rootCmd.AddCommand(fetchCmd)
+
+	mirrorCmd.Flags().StringVarP(&At, "at", "", "", "Target time as YYYY-MM-DD, RFC3339 or a Wayback timestamp (default now)")
+	mirrorCmd.Flags().StringVarP(&MirrorOptions.Dir, "dir", "d", MirrorOptions.Dir, "Output directory")
+	mirrorCmd.Flags().IntVarP(&MirrorOptions.Depth, "depth", "", MirrorOptions.Depth, "Number of links to follow from the start page")
+	mirrorCmd.Flags().StringVarP((*string)(&MirrorOptions.Scope), "scope", "", string(MirrorOptions.Scope), "Pages to follow: exact, prefix, host or domain")
+	mirrorCmd.Flags().DurationVarP(&MirrorOptions.Window, "window", "", MirrorOptions.Window, "Only use captures within this long of the start snapshot (0 for no limit)")
+	mirrorCmd.Flags().IntVarP(&MirrorOptions.Concurrency, "concurrency", "c", MirrorOptions.Concurrency, "Number of concurrent downloads")
+	rootCmd.AddCommand(mirrorCmd)
+
+	warcCmd.Flags().StringVarP(&Output, "output", "o", "", "Write the WARC to this file instead of stdout")
+	warcCmd.Flags().BoolVarP(&Gzip, "gzip", "z", false, "Gzip each record (default when --output ends with .gz)")
+	warcCmd.Flags().StringVarP(&From, "from", "", "", "Only export captures at or after this time")
+	warcCmd.Flags().StringVarP(&To, "to", "", "", "Only export captures at or before this time")
+	warcCmd.Flags().StringVarP(&MatchType, "match-type", "", MatchType, "URL matching: exact, prefix, host or domain")
+	warcCmd.Flags().StringSliceVarP(&Filters, "filter", "", nil, "CDX filter, e.g. \"statuscode:200\" (repeatable)")
+	warcCmd.Flags().IntVarP(&Limit, "limit", "", 0, "Max number of captures to export (0 for all)")
+	rootCmd.AddCommand(warcCmd)
+
+	indexCmd.Flags().StringVarP(&Output, "output", "o", "", "Write the index to this file instead of stdout")
+	indexCmd.Flags().BoolVarP(&CDXJ, "cdxj", "", false, "Write CDXJ instead of 11 field CDX")
+	rootCmd.AddCommand(indexCmd)
+
+	serveCmd.Flags().StringVarP(&Listen, "listen", "l", Listen, "Address to listen on")
+	serveCmd.Flags().StringVarP(&WARCDir, "dir", "d", WARCDir, "Directory holding the WARC and ARC files named by the index")
+	rootCmd.AddCommand(serveCmd)
 }
 
 func main() {
@@ -40,6 +101,12 @@ var rootCmd = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 	PreRun: func(_ *cobra.Command, _ []string) {
 		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
+		if err := initLocalIndex(); err != nil {
+			errorExit(err)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		snapshots, err := archiveorg.Search(args[0], RequestTimeout)
@@ -58,6 +125,357 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+var closestCmd = &cobra.Command{
+	Use:   "closest <url>",
+	Short: "find the snapshot closest to a point in time",
+	Long:  "command-line interface for finding the archive.org snapshot of a URL closest to a given time",
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
+		if err := initLocalIndex(); err != nil {
+			errorExit(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		at := time.Now()
+		if At != "" {
+			var err error
+			if at, err = parseTime(At); err != nil {
+				errorExit(err)
+			}
+		}
+
+		snapshot, err := archiveorg.Closest(args[0], at, RequestTimeout)
+		if err != nil {
+			errorExit(err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+
+		if err := enc.Encode(snapshot); err != nil {
+			errorExit(fmt.Errorf("marshalling snapshot to JSON: %s", err))
+		}
+	},
+}
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch <url>",
+	Short: "download archived content",
+	Long:  "command-line interface for downloading the archive.org capture of a URL closest to a given time",
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
+		if err := initLocalIndex(); err != nil {
+			errorExit(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var at time.Time
+		if At != "" {
+			var err error
+			if at, err = parseTime(At); err != nil {
+				errorExit(err)
+			}
+		}
+
+		if archiveorg.LocalIndex != nil {
+			// Fetch exactly the indexed capture closest to the requested time.
+			snapshot, err := archiveorg.Closest(args[0], at, RequestTimeout)
+			if err != nil {
+				errorExit(err)
+			}
+			at = snapshot.Timestamp
+		}
+
+		content, err := archiveorg.FetchSnapshot(args[0], at, archiveorg.Modifier(Modifier), RequestTimeout)
+		if err != nil {
+			errorExit(err)
+		}
+
+		log.WithField("url", content.URL).WithField("timestamp", content.Timestamp).Debugf("Fetched %v bytes", len(content.Body))
+		if content.StatusCode/100 != 2 {
+			log.WithField("url", content.URL).Warnf("Archived capture has status %v", content.StatusCode)
+		}
+
+		if Unrewrite {
+			content.Body = archiveorg.Unrewrite(content.Body)
+		}
+
+		if ShowHeaders {
+			if err := content.Header.Write(os.Stderr); err != nil {
+				errorExit(err)
+			}
+		}
+
+		if Output == "" || Output == "-" {
+			if _, err := os.Stdout.Write(content.Body); err != nil {
+				errorExit(err)
+			}
+			return
+		}
+		if err := ioutil.WriteFile(Output, content.Body, 0644); err != nil {
+			errorExit(fmt.Errorf("writing %v: %s", Output, err))
+		}
+	},
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <url>",
+	Short: "download a browsable offline copy of an archived site",
+	Long:  "command-line interface for mirroring the archive.org snapshot of a site closest to a given time to a local directory\n\nEmits one JSON line per mirrored URL.",
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
+		if err := initLocalIndex(); err != nil {
+			errorExit(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		at := time.Now()
+		if At != "" {
+			var err error
+			if at, err = parseTime(At); err != nil {
+				errorExit(err)
+			}
+		}
+
+		switch MirrorOptions.Scope {
+		case archiveorg.MatchExact, archiveorg.MatchPrefix, archiveorg.MatchHost, archiveorg.MatchDomain:
+		default:
+			errorExit(fmt.Errorf("unrecognized scope %q", MirrorOptions.Scope))
+		}
+
+		snapshot, err := archiveorg.Closest(args[0], at, RequestTimeout)
+		if err != nil {
+			errorExit(err)
+		}
+
+		results, err := archiveorg.Mirror(context.Background(), *snapshot, MirrorOptions, RequestTimeout)
+		if err != nil {
+			errorExit(err)
+		}
+
+		var (
+			enc    = json.NewEncoder(os.Stdout)
+			failed int
+		)
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+			}
+			if err := enc.Encode(result); err != nil {
+				errorExit(fmt.Errorf("marshalling result to JSON: %s", err))
+			}
+		}
+
+		fmt.Fprintf(os.Stderr, "Mirrored %v of %v URLs to %v\n", len(results)-failed, len(results), MirrorOptions.Dir)
+
+		if failed == len(results) {
+			errorExit("nothing mirrored")
+		}
+	},
+}
+
+var warcCmd = &cobra.Command{
+	Use:   "warc <url>",
+	Short: "export archived captures to a WARC file",
+	Long:  "command-line interface for exporting the original content of archive.org captures of a URL as WARC/1.1 response and metadata records",
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
+		if err := initLocalIndex(); err != nil {
+			errorExit(err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		q := archiveorg.CDXQuery{
+			URL:       args[0],
+			MatchType: archiveorg.MatchType(MatchType),
+			Filters:   Filters,
+		}
+		var err error
+		if From != "" {
+			if q.From, err = parseTime(From); err != nil {
+				errorExit(err)
+			}
+		}
+		if To != "" {
+			if q.To, err = parseTime(To); err != nil {
+				errorExit(err)
+			}
+		}
+
+		var (
+			w        io.Writer = os.Stdout
+			filename string
+		)
+		if Output != "" && Output != "-" {
+			f, err := os.Create(Output)
+			if err != nil {
+				errorExit(err)
+			}
+			defer f.Close()
+			w = f
+			filename = filepath.Base(Output)
+			if strings.HasSuffix(Output, ".gz") {
+				Gzip = true
+			}
+		}
+
+		var (
+			ctx      = context.Background()
+			client   = archiveorg.NewClient()
+			ww       = archiveorg.NewWARCWriter(w, Gzip)
+			exported int
+			failed   int
+		)
+		client.RequestTimeout = RequestTimeout
+
+		if err := ww.WriteWarcinfo(filename); err != nil {
+			errorExit(err)
+		}
+
+		it := client.CDXIterator(ctx, q)
+		for it.Next() && (Limit <= 0 || exported+failed < Limit) {
+			record := it.Record()
+			if err := client.ExportWARCRecords(ctx, ww, record); err != nil {
+				log.WithField("url", record.Original).WithField("timestamp", record.Timestamp).Warnf("Export failed: %s", err)
+				failed++
+				continue
+			}
+			exported++
+		}
+		if err := it.Err(); err != nil {
+			errorExit(err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported %v captures (%v failed)\n", exported, failed)
+
+		if exported == 0 && failed > 0 {
+			errorExit("nothing exported")
+		}
+	},
+}
+
+var indexCmd = &cobra.Command{
+	Use:   "index <file.warc.gz>...",
+	Short: "build a CDX index of local WARC or ARC files",
+	Long:  "command-line interface for indexing local WARC or ARC files as CDX or CDXJ, for use with --index",
+	Args:  cobra.MinimumNArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		idx := archiveorg.NewCDXIndex()
+		for _, name := range args {
+			f, err := os.Open(name)
+			if err != nil {
+				errorExit(err)
+			}
+			records, err := archiveorg.IndexWARC(f, filepath.Base(name))
+			f.Close()
+			if err != nil {
+				errorExit(err)
+			}
+			log.WithField("file", name).Debugf("Indexed %v records", len(records))
+			idx.Add(records...)
+		}
+
+		var w io.Writer = os.Stdout
+		if Output != "" && Output != "-" {
+			f, err := os.Create(Output)
+			if err != nil {
+				errorExit(err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		write := archiveorg.WriteCDX
+		if CDXJ {
+			write = archiveorg.WriteCDXJ
+		}
+		if err := write(w, idx.Records()); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve <index.cdx|file.warc.gz>...",
+	Short: "serve local WARC files through a Wayback Machine compatible API",
+	Long:  "command-line interface for replaying local WARC or ARC files, given directly or through CDX/CDXJ indexes, via the /cdx/search/cdx, /wayback/available, /web/timemap/ and /web/ endpoints",
+	Args:  cobra.MinimumNArgs(1),
+	PreRun: func(_ *cobra.Command, _ []string) {
+		initLogging()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		idx := archiveorg.NewCDXIndex()
+		for _, name := range args {
+			f, err := os.Open(name)
+			if err != nil {
+				errorExit(err)
+			}
+			if isWARC(name) {
+				// Filenames in the index are relative to --dir.
+				rel, err := filepath.Rel(WARCDir, name)
+				if err != nil || strings.HasPrefix(rel, "..") {
+					errorExit(fmt.Errorf("%v is not inside --dir %v", name, WARCDir))
+				}
+				records, err := archiveorg.IndexWARC(f, filepath.ToSlash(rel))
+				if err != nil {
+					errorExit(err)
+				}
+				idx.Add(records...)
+			} else {
+				loaded, err := archiveorg.LoadCDXIndex(f)
+				if err != nil {
+					errorExit(fmt.Errorf("loading %v: %s", name, err))
+				}
+				idx.Add(loaded.Records()...)
+			}
+			f.Close()
+		}
+
+		log.Infof("Serving %v captures on http://%v", len(idx.Records()), Listen)
+
+		if err := http.ListenAndServe(Listen, server.New(idx, http.Dir(WARCDir))); err != nil {
+			errorExit(err)
+		}
+	},
+}
+
+// isWARC reports whether name looks like a WARC or ARC file rather than an
+// index.
+func isWARC(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".gz")
+	return strings.HasSuffix(name, ".warc") || strings.HasSuffix(name, ".arc")
+}
+
+// parseTime accepts YYYY-MM-DD, RFC3339 or a (possibly truncated) Wayback
+// timestamp.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339, "20060102150405", "20060102", "200601", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format %q", s)
+}
+
 func errorExit(err interface{}) {
 	fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
 	os.Exit(1)
@@ -73,3 +491,32 @@ func initLogging() {
 	}
 	log.SetLevel(level)
 }
+
+func initRateLimits() error {
+	if Rate == "" {
+		return nil
+	}
+	rate, err := archiveorg.ParseRate(Rate)
+	if err != nil {
+		return err
+	}
+	for _, class := range []archiveorg.EndpointClass{archiveorg.EndpointCDX, archiveorg.EndpointTimeMap, archiveorg.EndpointContent} {
+		archiveorg.RateLimits[class] = archiveorg.NewRateLimiter(rate, 1)
+	}
+	return nil
+}
+
+func initLocalIndex() error {
+	if IndexFile == "" {
+		return nil
+	}
+	f, err := os.Open(IndexFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if archiveorg.LocalIndex, err = archiveorg.LoadCDXIndex(f); err != nil {
+		return fmt.Errorf("loading %v: %s", IndexFile, err)
+	}
+	return nil
+}
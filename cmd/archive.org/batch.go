@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"jaytaylor.com/archive.org"
+)
+
+// runBatch captures every URL from args and BatchFile, writing one JSON line
+// per URL to stdout followed by a summary on stderr.
+func runBatch(args []string) error {
+	var (
+		ctx    = context.Background()
+		urls   = make(chan string)
+		client = archiveorg.NewClient()
+		opts   = archiveorg.BatchOptions{
+			Concurrency:    Concurrency,
+			HostDelay:      HostDelay,
+			Wait:           Wait,
+			WaitTimeout:    WaitTimeout,
+			CaptureOptions: CaptureOptions,
+		}
+		readErr = make(chan error, 1)
+	)
+
+	client.RequestTimeout = RequestTimeout
+
+	go func() {
+		defer close(urls)
+		for _, arg := range args {
+			urls <- arg
+		}
+		readErr <- readURLs(BatchFile, urls)
+	}()
+
+	var (
+		enc    = json.NewEncoder(os.Stdout)
+		total  int
+		failed int
+	)
+
+	for result := range client.CaptureBatch(ctx, urls, opts) {
+		total++
+		if result.Err != nil {
+			failed++
+		}
+		if err := enc.Encode(&result); err != nil {
+			return fmt.Errorf("marshalling result to JSON: %s", err)
+		}
+	}
+
+	if err := <-readErr; err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Captured %v of %v URLs (%v failed)\n", total-failed, total, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%v capture(s) failed", failed)
+	}
+	return nil
+}
+
+// readURLs sends each non-empty, non-comment line of the named file ("-" for
+// stdin) to urls.
+func readURLs(filename string, urls chan<- string) error {
+	if filename == "" {
+		return nil
+	}
+
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return fmt.Errorf("opening URLs file: %s", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls <- line
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading URLs from %v: %s", filename, err)
+	}
+
+	log.WithField("file", filename).Debug("Finished reading URLs")
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -15,6 +17,13 @@ var (
 	Verbose        bool
 	Wait           bool
 	RequestTimeout time.Duration = archiveorg.DefaultRequestTimeout
+	WaitTimeout    time.Duration = 10 * time.Minute
+	CaptureOptions archiveorg.CaptureOptions
+	BatchFile      string
+	Concurrency    int           = 1
+	HostDelay      time.Duration = 5 * time.Second
+	Rate           string
+	CaptureRate    string
 )
 
 func init() {
@@ -24,6 +33,26 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.BaseURL, "base-url", "b", archiveorg.BaseURL, "Archive.org server base URL address")
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.HTTPHost, "http-host", "", archiveorg.HTTPHost, "'Host' header to use")
 	rootCmd.PersistentFlags().StringVarP(&archiveorg.UserAgent, "user-agent", "u", archiveorg.UserAgent, "'User-Agent' header to use")
+	rootCmd.PersistentFlags().StringVarP(&archiveorg.AccessKey, "access-key", "", archiveorg.AccessKey, "archive.org S3-style access key, enables Save Page Now 2 captures")
+	rootCmd.PersistentFlags().StringVarP(&archiveorg.SecretKey, "secret-key", "", archiveorg.SecretKey, "archive.org S3-style secret key")
+	rootCmd.PersistentFlags().StringVarP(&Rate, "rate", "", "", "Max request rate for every endpoint, e.g. \"1/s\" or \"30/m\" (default unlimited)")
+	rootCmd.PersistentFlags().StringVarP(&CaptureRate, "capture-rate", "", "", "Max Save Page Now capture request rate, e.g. \"12/m\" (default --rate)")
+
+	rootCmd.Flags().BoolVarP(&Wait, "wait", "w", false, "Block until the capture is available in the Wayback Machine")
+	rootCmd.Flags().DurationVarP(&WaitTimeout, "wait-timeout", "", WaitTimeout, "Maximum duration to wait for the capture with --wait")
+
+	rootCmd.Flags().StringVarP(&BatchFile, "file", "f", "", "Batch mode: read URLs to capture from file, one per line (\"-\" for stdin)")
+	rootCmd.Flags().IntVarP(&Concurrency, "concurrency", "c", Concurrency, "Batch mode: number of concurrent captures")
+	rootCmd.Flags().DurationVarP(&HostDelay, "host-delay", "", HostDelay, "Batch mode: minimum delay between captures of URLs on the same host")
+
+	rootCmd.Flags().BoolVarP(&CaptureOptions.CaptureAll, "capture-all", "", false, "Also capture error pages (4xx/5xx)")
+	rootCmd.Flags().BoolVarP(&CaptureOptions.CaptureOutlinks, "capture-outlinks", "", false, "Also capture the outlinks of the page")
+	rootCmd.Flags().BoolVarP(&CaptureOptions.CaptureScreenshot, "capture-screenshot", "", false, "Also capture a full page screenshot")
+	rootCmd.Flags().BoolVarP(&CaptureOptions.SkipFirstArchive, "skip-first-archive", "", false, "Skip checking whether this is the first archive of the URL")
+	rootCmd.Flags().BoolVarP(&CaptureOptions.ForceGet, "force-get", "", false, "Use a simple HTTP GET instead of a headless browser")
+	rootCmd.Flags().BoolVarP(&CaptureOptions.DelayWBAvailability, "delay-wb-availability", "", false, "Make the capture available in the Wayback Machine after ~12 hours")
+	rootCmd.Flags().DurationVarP(&CaptureOptions.JSBehaviorTimeout, "js-behavior-timeout", "", 0, "Run JS code for this long after page load (max 30s)")
+	rootCmd.Flags().DurationVarP(&CaptureOptions.IfNotArchivedWithin, "if-not-archived-within", "", 0, "Only capture when the latest existing capture is older than this")
 }
 
 func main() {
@@ -33,15 +62,42 @@ func main() {
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "archive.org",
+	Use:   "archive.org [url...]",
 	Short: "create a new snapshot of a URL",
-	Long:  "command-line interface for requesting archive.org perform a fresh crawl of a URL",
-	Args:  cobra.MinimumNArgs(1),
+	Long:  "command-line interface for requesting archive.org perform a fresh crawl of a URL\n\nWhen multiple URLs or --file are given, runs in batch mode and emits one JSON line per URL.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && BatchFile == "" {
+			return errors.New("requires at least 1 arg(s) or --file")
+		}
+		return nil
+	},
 	PreRun: func(_ *cobra.Command, _ []string) {
 		initLogging()
+		if err := initRateLimits(); err != nil {
+			errorExit(err)
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		location, err := archiveorg.Capture(args[0], RequestTimeout)
+		if len(args) > 1 || BatchFile != "" {
+			if err := runBatch(args); err != nil {
+				errorExit(err)
+			}
+			return
+		}
+
+		if Wait {
+			ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+			defer cancel()
+
+			snapshot, err := archiveorg.CaptureAndWait(ctx, args[0], CaptureOptions, RequestTimeout)
+			if err != nil {
+				errorExit(err)
+			}
+			fmt.Println(snapshot.URL)
+			return
+		}
+
+		location, err := archiveorg.CaptureWithOptions(args[0], CaptureOptions, RequestTimeout)
 		if err != nil {
 			errorExit(err)
 		}
@@ -64,3 +120,25 @@ func initLogging() {
 	}
 	log.SetLevel(level)
 }
+
+func initRateLimits() error {
+	rates := map[archiveorg.EndpointClass]string{}
+	for _, class := range []archiveorg.EndpointClass{archiveorg.EndpointCapture, archiveorg.EndpointCDX, archiveorg.EndpointTimeMap, archiveorg.EndpointContent} {
+		rates[class] = Rate
+	}
+	if CaptureRate != "" {
+		rates[archiveorg.EndpointCapture] = CaptureRate
+	}
+
+	for class, s := range rates {
+		if s == "" {
+			continue
+		}
+		rate, err := archiveorg.ParseRate(s)
+		if err != nil {
+			return err
+		}
+		archiveorg.RateLimits[class] = archiveorg.NewRateLimiter(rate, 1)
+	}
+	return nil
+}
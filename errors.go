@@ -0,0 +1,127 @@
+package archiveorg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors, test for them with errors.Is.
+var (
+	ErrNotArchived = errors.New("no snapshot found")                        // archive.org has no capture of the requested URL.
+	ErrExcluded    = errors.New("url is excluded from the wayback machine") // The URL is blocked, e.g. by robots.txt or at the owner's request.
+	ErrRateLimited = errors.New("rate limited by archive.org")              // Too many requests, see HTTPError.RetryAfter.
+)
+
+// maxErrorBodyLength caps the response body excerpt kept by HTTPError.
+const maxErrorBodyLength = 512
+
+// HTTPError is returned when archive.org replies with an unhappy status code.
+// It matches ErrNotArchived, ErrExcluded and ErrRateLimited with errors.Is
+// where appropriate.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration // Parsed from the 'Retry-After' header, if any.
+	Body       string        // Excerpt of the response body.
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%v request to %v received unhappy response status-code=%v", e.Method, e.URL, e.StatusCode)
+}
+
+// Is reports whether the error corresponds to one of the sentinel errors.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrNotArchived:
+		return e.StatusCode == http.StatusNotFound
+	case ErrExcluded:
+		if e.StatusCode == http.StatusUnavailableForLegalReasons {
+			return true
+		}
+		body := strings.ToLower(e.Body)
+		return e.StatusCode == http.StatusForbidden && (strings.Contains(body, "excluded") || strings.Contains(body, "robots.txt"))
+	}
+	return false
+}
+
+// newHTTPError builds an HTTPError from resp, consuming up to
+// maxErrorBodyLength bytes of the body.  The body is not closed.
+func newHTTPError(resp *http.Response) *HTTPError {
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		if e.Method == "" {
+			e.Method = "GET"
+		}
+		e.URL = resp.Request.URL.String()
+	}
+	if resp.Body != nil {
+		if excerpt, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength)); err == nil {
+			e.Body = string(excerpt)
+		}
+	}
+	return e
+}
+
+// parseRetryAfter parses a 'Retry-After' header value, given either in seconds
+// or as an HTTP-date.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// CaptureError is returned when Save Page Now rejects a capture request or the
+// capture job fails.
+type CaptureError struct {
+	JobID     string
+	URL       string
+	StatusExt string // e.g. "error:too-many-daily-captures".
+	Message   string
+}
+
+func (e *CaptureError) Error() string {
+	if e.JobID == "" {
+		return fmt.Sprintf("capture request for %v rejected: %v: %v", e.URL, e.StatusExt, e.Message)
+	}
+	return fmt.Sprintf("capture job %v for %v failed: %v: %v", e.JobID, e.URL, e.StatusExt, e.Message)
+}
+
+// Is reports whether the error corresponds to one of the sentinel errors.
+func (e *CaptureError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		switch e.StatusExt {
+		case "error:too-many-daily-captures", "error:user-session-limit", "error:too-many-requests":
+			return true
+		}
+	case ErrExcluded:
+		switch e.StatusExt {
+		case "error:blocked", "error:blocked-url", "error:blocked-client-ip", "error:robots":
+			return true
+		}
+	}
+	return false
+}
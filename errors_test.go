@@ -0,0 +1,95 @@
+package archiveorg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrorRateLimited(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "slow down")
+	}))
+
+	_, err := c.TimeMap("jaytaylor.com")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited but got %v", err)
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("Expected *HTTPError but got %T", err)
+	}
+	if expected, actual := 2*time.Minute, httpErr.RetryAfter; actual != expected {
+		t.Errorf("Expected RetryAfter=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "slow down", httpErr.Body; actual != expected {
+		t.Errorf("Expected Body=%q but actual=%q", expected, actual)
+	}
+	if errors.Is(err, ErrNotArchived) || errors.Is(err, ErrExcluded) {
+		t.Errorf("Rate limit error matched an unrelated sentinel: %v", err)
+	}
+}
+
+func TestHTTPErrorTimeMap(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		body       string
+		expected   error
+	}{
+		{http.StatusNotFound, "", ErrNotArchived},
+		{http.StatusForbidden, "This URL has been excluded from the Wayback Machine.", ErrExcluded},
+		{http.StatusUnavailableForLegalReasons, "", ErrExcluded},
+	}
+
+	for i, testCase := range testCases {
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(testCase.statusCode)
+			fmt.Fprint(w, testCase.body)
+		}))
+
+		_, err := c.TimeMap("jaytaylor.com")
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("[i=%v] Expected %v but got %v", i, testCase.expected, err)
+		}
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode != testCase.statusCode {
+			t.Errorf("[i=%v] Expected StatusCode=%v but actual=%v", i, testCase.statusCode, httpErr.StatusCode)
+		}
+	}
+}
+
+func TestCaptureErrorRateLimited(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"error","status_ext":"error:too-many-daily-captures","message":"Too many daily captures"}`)
+	}))
+	c.AccessKey = "key"
+	c.SecretKey = "secret"
+
+	_, err := c.Capture("https://jaytaylor.com/")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited but got %v", err)
+	}
+	var captureErr *CaptureError
+	if !errors.As(err, &captureErr) {
+		t.Fatalf("Expected *CaptureError but got %T", err)
+	}
+	if expected, actual := "error:too-many-daily-captures", captureErr.StatusExt; actual != expected {
+		t.Errorf("Expected StatusExt=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if expected, actual := 5*time.Second, parseRetryAfter("5"); actual != expected {
+		t.Errorf("Expected %v but actual=%v", expected, actual)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Expected roughly 1h but actual=%v", d)
+	}
+	if expected, actual := time.Duration(0), parseRetryAfter("soon"); actual != expected {
+		t.Errorf("Expected %v but actual=%v", expected, actual)
+	}
+}
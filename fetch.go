@@ -0,0 +1,132 @@
+package archiveorg
+
+// Retrieval of archived content, see
+// https://en.wikipedia.org/wiki/Help:Using_the_Wayback_Machine#Specific_archive_copy.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Modifier selects how the Wayback Machine serves an archived resource.
+type Modifier string
+
+const (
+	ModifierNone     Modifier = ""    // Rewritten for replay, with the Wayback toolbar.
+	ModifierIdentity Modifier = "id_" // Original, unrewritten bytes.
+	ModifierJS       Modifier = "js_" // Rewritten as JavaScript.
+	ModifierCSS      Modifier = "cs_" // Rewritten as a stylesheet.
+	ModifierImage    Modifier = "im_" // Served as an image.
+	ModifierIframe   Modifier = "if_" // Rewritten, without the toolbar (iframe content).
+	ModifierEmbed    Modifier = "oe_" // Rewritten, without the toolbar (embedded object).
+)
+
+// originalHeaderPrefix prefixes the archived response headers in replay
+// responses.
+const originalHeaderPrefix = "X-Archive-Orig-"
+
+// SnapshotContent is an archived resource as served by the Wayback Machine.
+type SnapshotContent struct {
+	URL        string      // Final replay URL, after redirects to the closest capture.
+	Timestamp  time.Time   // Capture time, from the 'Memento-Datetime' header.
+	StatusCode int         // Archived status code; captured errors such as a 404 are replayed with their original status.
+	Header     http.Header // Original response headers, from the 'X-Archive-Orig-*' headers.
+	Body       []byte
+}
+
+// FetchSnapshot downloads the capture of u closest to timestamp using the
+// package-level default client settings.
+func FetchSnapshot(u string, timestamp time.Time, modifier Modifier, timeout ...time.Duration) (*SnapshotContent, error) {
+	return defaultClient(timeout...).FetchSnapshot(u, timestamp, modifier)
+}
+
+// FetchSnapshotContext is like FetchSnapshot but aborts when ctx is done.
+func FetchSnapshotContext(ctx context.Context, u string, timestamp time.Time, modifier Modifier, timeout ...time.Duration) (*SnapshotContent, error) {
+	return defaultClient(timeout...).FetchSnapshotContext(ctx, u, timestamp, modifier)
+}
+
+// FetchSnapshot downloads the capture of u closest to timestamp, served
+// according to modifier.  Use ModifierIdentity for the original bytes.  A zero
+// timestamp selects the most recent capture.
+func (c *Client) FetchSnapshot(u string, timestamp time.Time, modifier Modifier) (*SnapshotContent, error) {
+	return c.FetchSnapshotContext(context.Background(), u, timestamp, modifier)
+}
+
+// FetchSnapshotContext is like FetchSnapshot but aborts when ctx is done.
+func (c *Client) FetchSnapshotContext(ctx context.Context, u string, timestamp time.Time, modifier Modifier) (*SnapshotContent, error) {
+	if err := modifier.validate(); err != nil {
+		return nil, err
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	replayURL := fmt.Sprintf("%v/web/%v%v/%v", c.BaseURL, timestamp.UTC().Format(timestampLayout), modifier, u)
+
+	var (
+		resp *http.Response
+		body []byte
+	)
+	err := c.retry(ctx, replayURL, func() error {
+		req, err := c.newRequest(ctx, "", replayURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, body, err = c.doAccept(req, isReplayedCapture)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content := &SnapshotContent{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     originalHeaders(resp.Header),
+		Body:       body,
+	}
+	if datetime := resp.Header.Get("Memento-Datetime"); datetime != "" {
+		if ts, err := time.Parse(mementoLayout, datetime); err == nil {
+			content.Timestamp = ts
+		}
+	}
+	return content, nil
+}
+
+// isReplayedCapture reports whether resp replays an archived response, which
+// may itself have been an error such as a 404, rather than being an error of
+// the replay endpoint.  Only replays carry the Memento-Datetime and
+// X-Archive-Orig-* headers.
+func isReplayedCapture(resp *http.Response) bool {
+	if resp.Header.Get("Memento-Datetime") != "" {
+		return true
+	}
+	return len(originalHeaders(resp.Header)) > 0
+}
+
+func (modifier Modifier) validate() error {
+	switch modifier {
+	case ModifierNone, ModifierIdentity, ModifierJS, ModifierCSS, ModifierImage, ModifierIframe, ModifierEmbed:
+		return nil
+	}
+	return fmt.Errorf("unsupported modifier %q", string(modifier))
+}
+
+// originalHeaders extracts the archived response headers from a replay
+// response's 'X-Archive-Orig-*' headers.
+func originalHeaders(header http.Header) http.Header {
+	orig := http.Header{}
+	for k, vs := range header {
+		if !strings.HasPrefix(k, originalHeaderPrefix) {
+			continue
+		}
+		name := http.CanonicalHeaderKey(strings.TrimPrefix(k, originalHeaderPrefix))
+		for _, v := range vs {
+			orig.Add(name, v)
+		}
+	}
+	return orig
+}
@@ -0,0 +1,100 @@
+package archiveorg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchSnapshot(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/web/20180101000000id_/https://jaytaylor.com/":
+			// Redirect to the closest capture, like the Wayback Machine does.
+			w.Header().Set("Location", "/web/20180326070330id_/https://jaytaylor.com/")
+			w.WriteHeader(http.StatusFound)
+		case "/web/20180326070330id_/https://jaytaylor.com/":
+			w.Header().Set("Memento-Datetime", "Mon, 26 Mar 2018 07:03:30 GMT")
+			w.Header().Set("X-Archive-Orig-Content-Type", "text/html; charset=utf-8")
+			w.Header().Add("X-Archive-Orig-Set-Cookie", "a=1")
+			w.Header().Add("X-Archive-Orig-Set-Cookie", "b=2")
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html>original</html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	content, err := c.FetchSnapshot("https://jaytaylor.com/", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), ModifierIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "<html>original</html>", string(content.Body); actual != expected {
+		t.Errorf("Expected body=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := c.BaseURL+"/web/20180326070330id_/https://jaytaylor.com/", content.URL; actual != expected {
+		t.Errorf("Expected URL=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := time.Date(2018, 3, 26, 7, 3, 30, 0, time.UTC), content.Timestamp; !actual.Equal(expected) {
+		t.Errorf("Expected timestamp=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := "text/html; charset=utf-8", content.Header.Get("Content-Type"); actual != expected {
+		t.Errorf("Expected original Content-Type=%q but actual=%q", expected, actual)
+	}
+	if expected, actual := 2, len(content.Header["Set-Cookie"]); actual != expected {
+		t.Errorf("Expected %v original Set-Cookie headers but actual=%v", expected, actual)
+	}
+	if _, ok := content.Header["Memento-Datetime"]; ok {
+		t.Errorf("Expected replay headers to be excluded from the original headers")
+	}
+
+	if _, err := c.FetchSnapshot("https://jaytaylor.com/", time.Time{}, Modifier("xx_")); err == nil {
+		t.Errorf("Expected error for unsupported modifier")
+	}
+}
+
+func TestFetchSnapshotArchivedError(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/web/20180326070330id_/https://jaytaylor.com/gone":
+			// A captured 404 is replayed with its original status.
+			w.Header().Set("Memento-Datetime", "Mon, 26 Mar 2018 07:03:30 GMT")
+			w.Header().Set("X-Archive-Orig-Content-Type", "text/plain")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "archived not found page")
+		case "/web/20180326070330id_/https://jaytaylor.com/broken":
+			w.Header().Set("X-Archive-Orig-Content-Type", "text/plain")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "archived server error")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	c.RetryPolicy = fastRetryPolicy()
+
+	at := time.Date(2018, 3, 26, 7, 3, 30, 0, time.UTC)
+	testCases := map[string]struct {
+		statusCode int
+		body       string
+	}{
+		"https://jaytaylor.com/gone":   {http.StatusNotFound, "archived not found page"},
+		"https://jaytaylor.com/broken": {http.StatusInternalServerError, "archived server error"},
+	}
+	for u, expected := range testCases {
+		content, err := c.FetchSnapshot(u, at, ModifierIdentity)
+		if err != nil {
+			t.Errorf("[url=%v] Unexpected error: %s", u, err)
+			continue
+		}
+		if content.StatusCode != expected.statusCode || string(content.Body) != expected.body {
+			t.Errorf("[url=%v] Expected status=%v body=%q but actual status=%v body=%q", u, expected.statusCode, expected.body, content.StatusCode, content.Body)
+		}
+	}
+
+	// A 404 from the replay endpoint itself means there is no capture.
+	if _, err := c.FetchSnapshot("https://jaytaylor.com/never", at, ModifierIdentity); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Expected ErrNotArchived but actual=%v", err)
+	}
+}
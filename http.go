@@ -1,19 +1,21 @@
 package archiveorg
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"time"
 	// "github.com/moul/http2curl"
 	// log "github.com/sirupsen/logrus"
 )
 
-func doRequest(method string, url string, body io.ReadCloser, timeout time.Duration) (*http.Response, []byte, error) {
-	req, err := newRequest(method, url, body)
+func (c *Client) doRequest(ctx context.Context, method string, url string, body io.ReadCloser) (*http.Response, []byte, error) {
+	req, err := c.newRequest(ctx, method, url, body)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -22,20 +24,32 @@ func doRequest(method string, url string, body io.ReadCloser, timeout time.Durat
 		req.Header.Set("content-type", "application/x-www-form-urlencoded")
 	}
 
+	return c.do(req)
+}
+
+// do executes req and reads the full response body.
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	return c.doAccept(req, nil)
+}
+
+// doAccept is like do, but a non-2xx/3xx response for which accept returns
+// true is returned with its body instead of as an HTTPError.
+func (c *Client) doAccept(req *http.Request, accept func(*http.Response) bool) (*http.Response, []byte, error) {
 	// cc, _ := http2curl.GetCurlCommand(req)
 	// log.Debugf("Equivalent command: %v", cc)
 
-	client := newClient(timeout)
-	resp, err := client.Do(req)
+	resp, err := c.httpClient().Do(req)
 	if err != nil {
-		return resp, nil, fmt.Errorf("executing request to %v: %s", url, err)
+		return resp, nil, fmt.Errorf("executing request to %v: %w", req.URL, err)
 	}
-	if resp.StatusCode/100 != 2 && resp.StatusCode/100 != 3 {
-		return resp, nil, fmt.Errorf("%v request to %v received unhappy response status-code=%v", method, url, resp.StatusCode)
+	if resp.StatusCode/100 != 2 && resp.StatusCode/100 != 3 && (accept == nil || !accept(resp)) {
+		err := newHTTPError(resp)
+		resp.Body.Close()
+		return resp, nil, err
 	}
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return resp, nil, fmt.Errorf("reading response body: %s", err)
+		return resp, nil, fmt.Errorf("reading response body: %w", err)
 	}
 	if err := resp.Body.Close(); err != nil {
 		return resp, respBody, fmt.Errorf("closing response body: %s", err)
@@ -43,21 +57,32 @@ func doRequest(method string, url string, body io.ReadCloser, timeout time.Durat
 	return resp, respBody, nil
 }
 
-func newRequest(method string, url string, body io.ReadCloser) (*http.Request, error) {
+func (c *Client) newRequest(ctx context.Context, method string, url string, body io.ReadCloser) (*http.Request, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("creating %v request to %v: %s", method, url, err)
 	}
+	req = req.WithContext(ctx)
 
-	req.Host = HTTPHost
+	req.Host = c.HTTPHost
 
-	hostname := strings.Split(BaseURL, "://")[1]
+	hostname := c.BaseURL
+	if pieces := strings.SplitN(c.BaseURL, "://", 2); len(pieces) == 2 {
+		hostname = pieces[1]
+	}
 	req.Header.Set("Host", hostname)
 	req.Header.Set("Origin", hostname)
 	req.Header.Set("Authority", hostname)
-	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("User-Agent", c.UserAgent)
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Referer", BaseURL+"/")
+	req.Header.Set("Referer", c.BaseURL+"/")
+
+	for k, vs := range c.Header {
+		req.Header.Del(k)
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
 
 	return req, nil
 }
@@ -78,3 +103,16 @@ func newClient(timeout time.Duration) *http.Client {
 	}
 	return c
 }
+
+// resolveReference resolves ref, which may be relative, against base.
+func resolveReference(base string, ref string) string {
+	b, err := neturl.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := neturl.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
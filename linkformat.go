@@ -0,0 +1,242 @@
+package archiveorg
+
+// Link header / application/link-format parser as described in RFC 8288
+// section 3:
+//
+//	Link       = #link-value
+//	link-value = "<" URI-Reference ">" *( OWS ";" OWS link-param )
+//	link-param = token BWS [ "=" BWS ( token / quoted-string ) ]
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseLinkHeader parses a complete Link header value, or application/link-format
+// document, into one Memento per link-value.
+func ParseLinkHeader(header string) ([]*Memento, error) {
+	p := &linkParser{s: header}
+	return p.parse()
+}
+
+// HasRel returns true when rel is one of the (space separated) relation types
+// of the memento, e.g. "memento" for rel="first last memento".
+func (m *Memento) HasRel(rel string) bool {
+	for _, r := range strings.Fields(m.Rel) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+type linkParser struct {
+	s   string
+	pos int
+}
+
+func (p *linkParser) parse() ([]*Memento, error) {
+	links := []*Memento{}
+
+	for {
+		p.skipWhitespace()
+		if p.eof() {
+			return links, nil
+		}
+		// Empty list elements are permitted.
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+
+		m, err := p.parseLinkValue()
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, m)
+
+		p.skipWhitespace()
+		if !p.eof() && p.peek() != ',' {
+			return nil, p.errorf("expected ',' between link-values but found %q", p.peek())
+		}
+	}
+}
+
+func (p *linkParser) parseLinkValue() (*Memento, error) {
+	if p.peek() != '<' {
+		return nil, p.errorf("expected '<' but found %q", p.peek())
+	}
+	end := strings.IndexByte(p.s[p.pos:], '>')
+	if end < 0 {
+		return nil, p.errorf("unterminated URI-Reference")
+	}
+
+	m := &Memento{
+		URL: p.s[p.pos+1 : p.pos+end],
+	}
+	p.pos += end + 1
+
+	for {
+		p.skipWhitespace()
+		if p.eof() || p.peek() != ';' {
+			return m, nil
+		}
+		p.pos++
+		p.skipWhitespace()
+
+		name := strings.ToLower(p.token())
+		if name == "" {
+			// Tolerate a trailing or doubled ';'.
+			continue
+		}
+
+		var value string
+		p.skipWhitespace()
+		if !p.eof() && p.peek() == '=' {
+			p.pos++
+			p.skipWhitespace()
+			if !p.eof() && p.peek() == '"' {
+				var err error
+				if value, err = p.quotedString(); err != nil {
+					return nil, err
+				}
+			} else {
+				value = p.token()
+			}
+		}
+
+		if err := m.setParam(name, value); err != nil {
+			return nil, p.errorf("%s", err)
+		}
+	}
+}
+
+// setParam applies a single link-param to the memento.  Per RFC 8288 only the
+// first occurrence of rel is honored.
+func (m *Memento) setParam(name string, value string) error {
+	switch name {
+	case "rel":
+		if m.Rel == "" {
+			m.Rel = strings.Join(strings.Fields(value), " ")
+		}
+
+	case "type":
+		typ := value
+		m.Type = &typ
+
+	case "from", "until", "datetime":
+		t, err := time.Parse(mementoLayout, value)
+		if err != nil {
+			return fmt.Errorf("invalid %v value %q: %s", name, value, err)
+		}
+		switch name {
+		case "from":
+			m.From = &t
+		case "until":
+			m.Until = &t
+		default:
+			m.Time = &t
+		}
+
+	default:
+		if m.Params == nil {
+			m.Params = map[string]string{}
+		}
+		m.Params[name] = value
+	}
+	return nil
+}
+
+func (p *linkParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *linkParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *linkParser) skipWhitespace() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// token consumes and returns a (possibly empty) token.
+func (p *linkParser) token() string {
+	start := p.pos
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n', ';', ',', '=', '"', '<', '>':
+			return p.s[start:p.pos]
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// quotedString consumes a quoted-string and returns its unescaped contents.
+func (p *linkParser) quotedString() (string, error) {
+	var buf bytes.Buffer
+	for p.pos++; !p.eof(); p.pos++ {
+		switch ch := p.peek(); ch {
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unterminated quoted-string")
+			}
+			buf.WriteByte(p.peek())
+		case '"':
+			p.pos++
+			return buf.String(), nil
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return "", p.errorf("unterminated quoted-string")
+}
+
+func (p *linkParser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.s[:p.pos], "\n")
+	return fmt.Errorf("%s: on line %v: %s", MementoParseErr, line, fmt.Sprintf(format, args...))
+}
+
+// linkValue renders the memento as a single link-value.
+func (m *Memento) linkValue() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%v>; rel=%v", m.URL, quoteString(m.Rel))
+	if m.Type != nil {
+		fmt.Fprintf(&b, "; type=%v", quoteString(*m.Type))
+	}
+	if m.From != nil {
+		fmt.Fprintf(&b, "; from=%v", quoteString(m.From.UTC().Format(http.TimeFormat)))
+	}
+	if m.Until != nil {
+		fmt.Fprintf(&b, "; until=%v", quoteString(m.Until.UTC().Format(http.TimeFormat)))
+	}
+	if m.Time != nil {
+		fmt.Fprintf(&b, "; datetime=%v", quoteString(m.Time.UTC().Format(http.TimeFormat)))
+	}
+	names := make([]string, 0, len(m.Params))
+	for name := range m.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "; %v=%v", name, quoteString(m.Params[name]))
+	}
+	return b.String()
+}
+
+// quoteString renders s as an RFC 7230 quoted-string.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
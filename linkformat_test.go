@@ -0,0 +1,95 @@
+package archiveorg
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	header := `<http://example.com/a,b>; rel="original",` +
+		` <http://web.archive.org/web/20010331114839/http://example.com/>;rel="first last memento" ; datetime="Sat, 31 Mar 2001 11:48:39 GMT"; title="a, \"quoted\"; title",` +
+		`<http://web.archive.org/web/timemap/link/http://example.com/>; rel=timemap; type=application/link-format; license="http://example.com/license"`
+
+	links, err := ParseLinkHeader(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 3, len(links); actual != expected {
+		t.Fatalf("Expected %v links but got %v", expected, actual)
+	}
+
+	if expected, actual := "http://example.com/a,b", links[0].URL; actual != expected {
+		t.Errorf("Expected URL=%v but got %v", expected, actual)
+	}
+
+	m := links[1]
+	if !m.HasRel("memento") || !m.HasRel("first") || !m.HasRel("last") || m.HasRel("original") {
+		t.Errorf("Unexpected rel value %q", m.Rel)
+	}
+	if m.Time == nil || m.Time.Year() != 2001 {
+		t.Errorf("Expected datetime in 2001 but got %v", m.Time)
+	}
+	if expected, actual := map[string]string{"title": `a, "quoted"; title`}, m.Params; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected Params=%v but got %v", expected, actual)
+	}
+
+	m = links[2]
+	if expected, actual := "timemap", m.Rel; actual != expected {
+		t.Errorf("Expected unquoted rel=%v but got %v", expected, actual)
+	}
+	if m.Type == nil || *m.Type != "application/link-format" {
+		t.Errorf("Expected unquoted type to be parsed but got %v", m.Type)
+	}
+	if expected, actual := "http://example.com/license", m.Params["license"]; actual != expected {
+		t.Errorf("Expected license=%v but got %v", expected, actual)
+	}
+}
+
+func TestParseLinkHeaderErrors(t *testing.T) {
+	inputs := []string{
+		`http://example.com/; rel="original"`,
+		`<http://example.com/; rel="original"`,
+		`<http://example.com/>; rel="original"; title="unterminated`,
+		`<http://example.com/>; rel="memento"; datetime="yesterday"`,
+		"<http://example.com/>; rel=\"original\",\n<http://example.com/> <http://example.com/>",
+	}
+
+	for i, input := range inputs {
+		if _, err := ParseLinkHeader(input); err == nil {
+			t.Errorf("[i=%v] Expected parse error for input %q", i, input)
+		}
+	}
+}
+
+func TestParseTimeMapWithoutTrailingComma(t *testing.T) {
+	input := strings.Join([]string{
+		`<http://example.com/>; rel="original",`,
+		`<http://web.archive.org/web/20010331114839/http://example.com/>; rel="first last memento"; datetime="Sat, 31 Mar 2001 11:48:39 GMT"; title="x"`,
+	}, "\n")
+
+	timemap, err := ParseTimeMap(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 1, len(timemap.Mementos); actual != expected {
+		t.Fatalf("Expected %v mementos but got %v", expected, actual)
+	}
+	if timemap.Original == nil {
+		t.Fatalf("Expected original to be set")
+	}
+
+	// Unrecognized params survive a round-trip.
+	buf := &bytes.Buffer{}
+	if err := timemap.WriteLinkFormat(buf); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseTimeMap(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "x", again.Mementos[0].Params["title"]; actual != expected {
+		t.Errorf("Expected title=%v after round-trip but got %q", expected, actual)
+	}
+}
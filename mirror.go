@@ -0,0 +1,459 @@
+package archiveorg
+
+// Offline mirroring of archived sites.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	mirrorTagExpr   = regexp.MustCompile(`(?is)<([a-z][a-z0-9]*)\b[^>]*>`)
+	mirrorAttrExpr  = regexp.MustCompile(`(?is)\b([a-z][a-z-]*)\s*=\s*("[^"]*"|'[^']*'|[^\s>"']+)`)
+	mirrorStyleExpr = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style>`)
+	mirrorCSSExpr   = regexp.MustCompile(`(?i)url\(\s*("[^"]*"|'[^']*'|[^)'"\s]*)\s*\)|@import\s+("[^"]*"|'[^']*')`)
+
+	// Extensions of server-side pages which browsers won't render from disk.
+	mirrorScriptExts = map[string]bool{".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true}
+)
+
+// MirrorOptions controls Mirror.
+type MirrorOptions struct {
+	Dir         string        // Output directory, one sub-directory per host.
+	Depth       int           // How many links to follow from the start page; 0 mirrors only the start page and its assets.
+	Scope       MatchType     // Which pages to follow: MatchExact, MatchPrefix (default), MatchHost or MatchDomain.
+	Window      time.Duration // Only use captures within this long of the start snapshot; 0 for no limit.
+	Concurrency int           // Number of concurrent downloads, defaults to 1.
+}
+
+// MirrorResult describes a single mirrored page or asset.
+type MirrorResult struct {
+	URL      string `json:"url"`
+	Path     string `json:"path,omitempty"`     // Written file, relative to MirrorOptions.Dir.
+	Snapshot string `json:"snapshot,omitempty"` // Capture the content was taken from.
+	Error    string `json:"error,omitempty"`
+	Err      error  `json:"-"`
+}
+
+// Mirror writes a browsable offline copy of the site around snap using the
+// package-level default client settings.
+func Mirror(ctx context.Context, snap Snapshot, opts MirrorOptions, timeout ...time.Duration) ([]MirrorResult, error) {
+	return defaultClient(timeout...).Mirror(ctx, snap, opts)
+}
+
+// Mirror writes a browsable offline copy of the site around snap to opts.Dir.
+//
+// Starting from the snapshot's page, the original (id_) content of linked pages
+// and assets is downloaded from the capture closest to the snapshot timestamp,
+// according to the CDX index.  Links to mirrored files are rewritten to
+// relative paths, other links point at the original site.  Pages are followed
+// up to opts.Depth links away when within opts.Scope; the images, scripts and
+// stylesheets of every mirrored page are downloaded regardless of host.
+//
+// One result is returned per URL, including those which could not be
+// mirrored.
+func (c *Client) Mirror(ctx context.Context, snap Snapshot, opts MirrorOptions) ([]MirrorResult, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("mirror: no output directory specified")
+	}
+	if opts.Scope == "" {
+		opts.Scope = MatchPrefix
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	root, err := url.Parse(UnrewriteURL(snap.URL))
+	if err != nil {
+		return nil, fmt.Errorf("mirror: parsing snapshot URL %q: %s", snap.URL, err)
+	}
+	if root.Host == "" {
+		return nil, fmt.Errorf("mirror: snapshot URL %q has no host", snap.URL)
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("mirror: %s", err)
+	}
+
+	m := &mirror{
+		client:    c,
+		opts:      opts,
+		root:      root,
+		timestamp: snap.Timestamp,
+		sem:       make(chan struct{}, opts.Concurrency),
+		paths:     map[string]bool{},
+	}
+	m.enqueue(ctx, root, 0, true)
+	m.wg.Wait()
+
+	return m.results, nil
+}
+
+type mirror struct {
+	client    *Client
+	opts      MirrorOptions
+	root      *url.URL
+	timestamp time.Time
+
+	wg  sync.WaitGroup
+	sem chan struct{}
+
+	mu      sync.Mutex
+	paths   map[string]bool // Claimed local paths.
+	results []MirrorResult
+}
+
+// enqueue schedules u for download, unless its local path is already taken,
+// and returns the local path.
+func (m *mirror) enqueue(ctx context.Context, u *url.URL, depth int, page bool) string {
+	local := mirrorPath(u, page)
+
+	m.mu.Lock()
+	claimed := m.paths[local]
+	m.paths[local] = true
+	m.mu.Unlock()
+
+	if claimed {
+		return local
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		select {
+		case m.sem <- struct{}{}:
+		case <-ctx.Done():
+			m.addResult(MirrorResult{URL: u.String(), Err: ctx.Err()})
+			return
+		}
+		defer func() { <-m.sem }()
+
+		m.addResult(m.fetch(ctx, u, depth, local))
+	}()
+
+	return local
+}
+
+func (m *mirror) claimed(local string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paths[local]
+}
+
+func (m *mirror) addResult(result MirrorResult) {
+	if result.Err != nil {
+		result.Error = result.Err.Error()
+		log.WithField("url", result.URL).Warnf("Mirroring failed: %s", result.Err)
+	}
+	m.mu.Lock()
+	m.results = append(m.results, result)
+	m.mu.Unlock()
+}
+
+// fetch downloads u from its closest capture, rewrites its links and writes it
+// to local.
+func (m *mirror) fetch(ctx context.Context, u *url.URL, depth int, local string) MirrorResult {
+	result := MirrorResult{
+		URL: u.String(),
+	}
+
+	record, err := m.closest(ctx, u.String())
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Snapshot = m.client.snapshotURL(record.Timestamp, record.Original)
+
+	content, err := m.client.FetchSnapshotContext(ctx, record.Original, record.Timestamp, ModifierIdentity)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	mimeType := record.MimeType
+	if contentType := content.Header.Get("Content-Type"); contentType != "" {
+		mimeType = contentType
+	}
+	mimeType = strings.ToLower(mimeType)
+
+	body := content.Body
+	switch {
+	case strings.Contains(mimeType, "html"):
+		body = []byte(m.rewriteHTML(ctx, string(body), u, depth, local))
+	case strings.Contains(mimeType, "css"):
+		body = []byte(m.rewriteCSS(ctx, string(body), u, depth, local))
+	}
+
+	file := filepath.Join(m.opts.Dir, filepath.FromSlash(local))
+	if rel, err := filepath.Rel(m.opts.Dir, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		result.Err = fmt.Errorf("mirror path %q escapes %v", local, m.opts.Dir)
+		return result
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		result.Err = err
+		return result
+	}
+	if err := ioutil.WriteFile(file, body, 0644); err != nil {
+		result.Err = err
+		return result
+	}
+
+	log.WithField("url", result.URL).WithField("path", local).Debug("Mirrored")
+
+	result.Path = local
+	return result
+}
+
+// closest finds the capture of u nearest the start snapshot.  The CDX server
+// sorts by distance so only a single row is transferred, rather than the
+// URL's entire capture history.
+func (m *mirror) closest(ctx context.Context, u string) (*CDXRecord, error) {
+	q := CDXQuery{
+		URL:     u,
+		Filters: []string{"!statuscode:[45].."},
+		Fields:  []string{"timestamp", "original", "mimetype", "statuscode"},
+		Closest: m.timestamp,
+		Limit:   1,
+	}
+	if m.opts.Window > 0 {
+		q.From = m.timestamp.Add(-m.opts.Window)
+		q.To = m.timestamp.Add(m.opts.Window)
+	}
+
+	records, err := m.client.CDXContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *CDXRecord
+	for i := range records {
+		if best == nil || absDuration(records[i].Timestamp.Sub(m.timestamp)) < absDuration(best.Timestamp.Sub(m.timestamp)) {
+			best = &records[i]
+		}
+	}
+	if best == nil {
+		return nil, ErrNotArchived
+	}
+	if best.Original == "" {
+		best.Original = u
+	}
+	return best, nil
+}
+
+// rewriteHTML discovers and rewrites the links of an HTML page.
+func (m *mirror) rewriteHTML(ctx context.Context, body string, base *url.URL, depth int, local string) string {
+	body = mirrorTagExpr.ReplaceAllStringFunc(body, func(tag string) string {
+		name := strings.ToLower(mirrorTagExpr.FindStringSubmatch(tag)[1])
+
+		return replaceSubmatches(mirrorAttrExpr, tag, 2, func(value string, match []string) string {
+			attr := strings.ToLower(match[1])
+
+			quote, raw := "", value
+			if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+				quote, raw = value[:1], value[1:len(value)-1]
+			}
+			raw = html.UnescapeString(raw)
+
+			var rewritten string
+			switch {
+			case attr == "style":
+				rewritten = m.rewriteCSS(ctx, raw, base, depth, local)
+			case attr == "srcset":
+				candidates := strings.Split(raw, ",")
+				for i, candidate := range candidates {
+					fields := strings.Fields(candidate)
+					if len(fields) > 0 {
+						fields[0] = m.link(ctx, base, fields[0], depth, false, local)
+					}
+					candidates[i] = strings.Join(fields, " ")
+				}
+				rewritten = strings.Join(candidates, ", ")
+			case (name == "a" || name == "area") && attr == "href",
+				(name == "iframe" || name == "frame") && attr == "src":
+				rewritten = m.link(ctx, base, raw, depth, true, local)
+			case attr == "src" || attr == "poster" || attr == "background" || (name == "link" && attr == "href") || (name == "object" && attr == "data"):
+				rewritten = m.link(ctx, base, raw, depth, false, local)
+			default:
+				return value
+			}
+
+			if quote == "" {
+				quote = `"`
+			}
+			return quote + escapeAttr(rewritten, quote) + quote
+		})
+	})
+
+	return replaceSubmatches(mirrorStyleExpr, body, 1, func(css string, _ []string) string {
+		return m.rewriteCSS(ctx, css, base, depth, local)
+	})
+}
+
+// rewriteCSS discovers and rewrites the url() and @import references of a
+// stylesheet.
+func (m *mirror) rewriteCSS(ctx context.Context, css string, base *url.URL, depth int, local string) string {
+	for _, group := range []int{1, 2} {
+		css = replaceSubmatches(mirrorCSSExpr, css, group, func(value string, _ []string) string {
+			quote, raw := "", value
+			if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+				quote, raw = value[:1], value[1:len(value)-1]
+			}
+			return quote + m.link(ctx, base, raw, depth, false, local) + quote
+		})
+	}
+	return css
+}
+
+// link resolves ref against base, schedules the target when it should be
+// mirrored and returns the reference to use from the page at local.
+func (m *mirror) link(ctx context.Context, base *url.URL, ref string, depth int, page bool, local string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ref
+	}
+
+	fragment := u.Fragment
+	u.Fragment = ""
+
+	// Pages which aren't followed are still linked locally when mirrored anyway.
+	if page && (depth >= m.opts.Depth || !m.inScope(u)) && !m.claimed(mirrorPath(u, page)) {
+		if fragment != "" {
+			return u.String() + "#" + fragment
+		}
+		return u.String()
+	}
+	if page {
+		depth++
+	}
+
+	target := mirrorPath(u, page)
+	if !m.claimed(target) {
+		target = m.enqueue(ctx, u, depth, page)
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(local)), filepath.FromSlash(target))
+	if err != nil {
+		return ref
+	}
+	rel = (&url.URL{Path: filepath.ToSlash(rel)}).String()
+	if fragment != "" {
+		rel += "#" + fragment
+	}
+	return rel
+}
+
+// inScope reports whether the page u should be followed.
+func (m *mirror) inScope(u *url.URL) bool {
+	var (
+		host     = strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))
+		rootHost = strings.ToLower(strings.TrimPrefix(m.root.Hostname(), "www."))
+	)
+	switch m.opts.Scope {
+	case MatchExact:
+		return false
+	case MatchHost:
+		return host == rootHost
+	case MatchDomain:
+		return host == rootHost || strings.HasSuffix(host, "."+rootHost)
+	default:
+		// Everything under the start page's directory.
+		dir := m.root.Path
+		if i := strings.LastIndex(dir, "/"); i >= 0 {
+			dir = dir[:i+1]
+		} else {
+			dir = "/"
+		}
+		return host == rootHost && (strings.HasPrefix(u.Path, dir) || u.Path+"/" == dir)
+	}
+}
+
+// mirrorPath maps u to a slash separated path relative to the mirror
+// directory.  Pages without an extension are written as <path>/index.html so
+// they can be opened from disk.
+func mirrorPath(u *url.URL, page bool) string {
+	p := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") || p == "/" {
+		p = path.Join(p, "index.html")
+	} else if ext := strings.ToLower(path.Ext(p)); page && ext == "" {
+		p = path.Join(p, "index.html")
+	} else if page && mirrorScriptExts[ext] {
+		p += ".html"
+	}
+
+	if u.RawQuery != "" {
+		ext := path.Ext(p)
+		p = strings.TrimSuffix(p, ext) + "@" + sanitizePathSegment(u.RawQuery) + ext
+	}
+
+	return sanitizePathSegment(u.Host) + p
+}
+
+// escapeAttr escapes s for use in an attribute value enclosed by quote.
+func escapeAttr(s string, quote string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", quote, html.EscapeString(quote)).Replace(s)
+}
+
+// sanitizePathSegment replaces characters which are troublesome in file names,
+// and escapes the "." and ".." directory references.
+func sanitizePathSegment(s string) string {
+	if s == "." || s == ".." {
+		return strings.Repeat("_", len(s))
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// replaceSubmatches replaces submatch group of every match of expr in s with
+// the result of fn, which also receives the full set of submatches.
+func replaceSubmatches(expr *regexp.Regexp, s string, group int, fn func(value string, match []string) string) string {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, loc := range expr.FindAllStringSubmatchIndex(s, -1) {
+		start, end := loc[2*group], loc[2*group+1]
+		if start < 0 {
+			continue
+		}
+		match := make([]string, len(loc)/2)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = s[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(fn(s[start:end], match))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,153 @@
+package archiveorg
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirror(t *testing.T) {
+	type resource struct {
+		mimeType string
+		body     string
+	}
+	site := map[string]resource{
+		"https://docs.example.com/guide/": {"text/html", `<html><head><link rel="stylesheet" href="style.css"></head><body>
+<a href="page2.html#intro">Next</a>
+<a href="/other/out.html">Out of scope</a>
+<a href="https://elsewhere.com/">Elsewhere</a>
+<img src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x">
+</body></html>`},
+		"https://docs.example.com/guide/page2.html":   {"text/html", `<a href="./">Home</a> <a href="page3.html">Too deep</a> <div style="background: url('img/logo.png')"></div>`},
+		"https://docs.example.com/guide/style.css":    {"text/css", `body { background: url(img/bg.png); }`},
+		"https://docs.example.com/guide/img/logo.png": {"image/png", "logo"},
+		"https://docs.example.com/guide/img/bg.png":   {"image/png", "bg"},
+		// logo@2x.png was never captured.
+	}
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cdx/search/cdx" {
+			if q := r.URL.Query(); q.Get("limit") != "1" || q.Get("sort") != "closest" || q.Get("closest") != "20180101000000" {
+				t.Errorf("Expected a single closest capture to be requested but actual query=%v", r.URL.RawQuery)
+			}
+			rows := [][]string{}
+			if res, ok := site[r.URL.Query().Get("url")]; ok {
+				rows = append(rows, []string{"timestamp", "original", "mimetype", "statuscode"})
+				rows = append(rows, []string{"20180101000000", r.URL.Query().Get("url"), res.mimeType, "200"})
+			}
+			json.NewEncoder(w).Encode(rows)
+			return
+		}
+		if res, ok := site[strings.TrimPrefix(r.URL.Path, "/web/20180101000000id_/")]; ok {
+			w.Header().Set("X-Archive-Orig-Content-Type", res.mimeType)
+			w.Write([]byte(res.body))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+
+	dir, err := ioutil.TempDir("", "archiveorg-mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	snap := Snapshot{
+		URL:       c.BaseURL + "/web/20180101000000/https://docs.example.com/guide/",
+		Timestamp: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	results, err := c.Mirror(context.Background(), snap, MirrorOptions{Dir: dir, Depth: 1, Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mirrored, failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result.URL)
+		} else {
+			mirrored = append(mirrored, result.Path)
+		}
+	}
+	sort.Strings(mirrored)
+
+	expected := []string{
+		"docs.example.com/guide/img/bg.png",
+		"docs.example.com/guide/img/logo.png",
+		"docs.example.com/guide/index.html",
+		"docs.example.com/guide/page2.html",
+		"docs.example.com/guide/style.css",
+	}
+	if strings.Join(mirrored, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected mirrored=%v but actual=%v", expected, mirrored)
+	}
+	if len(failed) != 1 || failed[0] != "https://docs.example.com/guide/img/logo@2x.png" {
+		t.Errorf("Expected only logo@2x.png to fail but actual=%v", failed)
+	}
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	index := read("docs.example.com/guide/index.html")
+	for _, s := range []string{
+		`href="style.css"`,
+		`href="page2.html#intro"`,
+		`href="https://docs.example.com/other/out.html"`,
+		`href="https://elsewhere.com/"`,
+		`src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x"`,
+	} {
+		if !strings.Contains(index, s) {
+			t.Errorf("Expected index.html to contain %q:\n%v", s, index)
+		}
+	}
+
+	page2 := read("docs.example.com/guide/page2.html")
+	for _, s := range []string{`href="index.html"`, `href="https://docs.example.com/guide/page3.html"`, `url('img/logo.png')`} {
+		if !strings.Contains(page2, s) {
+			t.Errorf("Expected page2.html to contain %q:\n%v", s, page2)
+		}
+	}
+
+	if expected, actual := `body { background: url(img/bg.png); }`, read("docs.example.com/guide/style.css"); actual != expected {
+		t.Errorf("Expected style.css=%q but actual=%q", expected, actual)
+	}
+}
+
+func TestMirrorPath(t *testing.T) {
+	testCases := []struct {
+		url      string
+		page     bool
+		expected string
+	}{
+		{"https://example.com", true, "example.com/index.html"},
+		{"https://example.com/docs/", true, "example.com/docs/index.html"},
+		{"https://example.com/docs/intro", true, "example.com/docs/intro/index.html"},
+		{"https://example.com/docs/intro", false, "example.com/docs/intro"},
+		{"https://example.com/list.php?page=2", true, "example.com/list.php@page_2.html"},
+		{"http://example.com:8080/../a.css", false, "example.com_8080/a.css"},
+		{"http://../a.css", false, "__/a.css"},
+		{"http://./", true, "_/index.html"},
+	}
+	for i, testCase := range testCases {
+		u, err := url.Parse(testCase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := mirrorPath(u, testCase.page); actual != testCase.expected {
+			t.Errorf("[i=%v] Expected %v but actual=%v", i, testCase.expected, actual)
+		}
+	}
+}
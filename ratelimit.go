@@ -0,0 +1,145 @@
+package archiveorg
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointClass groups archive.org endpoints which share a rate limit.
+type EndpointClass string
+
+const (
+	EndpointCapture EndpointClass = "capture" // Save Page Now requests and capture status polls.
+	EndpointCDX     EndpointClass = "cdx"     // CDX, sparkline, calendar and availability lookups.
+	EndpointTimeMap EndpointClass = "timemap" // TimeMap downloads.
+	EndpointContent EndpointClass = "content" // Snapshot content and TimeGate requests.
+)
+
+// RateLimits holds the package-level default rate limiters, copied into each
+// new Client.  Classes without a limiter are not rate limited.  Limiters are
+// shared by reference, so all clients created after an assignment draw from the
+// same buckets.
+var RateLimits = map[EndpointClass]*RateLimiter{}
+
+// RateLimiter is a token bucket, safe for concurrent use.  A nil *RateLimiter
+// never blocks.
+type RateLimiter struct {
+	rate  float64 // Tokens added per second.
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second on
+// average, and bursts of up to burst requests.  A rate of 0 or less disables
+// limiting.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	return l
+}
+
+// Wait blocks until a request may be made, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// Hand back the reserved token.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ParseRate parses a rate such as "2", "2/s", "30/m" or "100/h" into requests
+// per second.
+func ParseRate(s string) (float64, error) {
+	var (
+		pieces = strings.SplitN(strings.TrimSpace(s), "/", 2)
+		per    = time.Second
+	)
+	if len(pieces) == 2 {
+		switch strings.ToLower(strings.TrimSpace(pieces[1])) {
+		case "s", "sec", "second":
+		case "m", "min", "minute":
+			per = time.Minute
+		case "h", "hour":
+			per = time.Hour
+		default:
+			return 0, fmt.Errorf("invalid rate %q: unrecognized unit %q", s, pieces[1])
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(pieces[0]), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n / per.Seconds(), nil
+}
+
+// waitRateLimit blocks until the rate limiter for the endpoint class of u
+// allows another request.
+func (c *Client) waitRateLimit(ctx context.Context, u string) error {
+	return c.RateLimits[endpointClassFor(c.BaseURL, u)].Wait(ctx)
+}
+
+// endpointClassFor classifies a request URL by its path relative to baseURL,
+// which may itself have a path, e.g. when archive.org is reached through a
+// proxy.
+func endpointClassFor(baseURL string, u string) EndpointClass {
+	path := u
+	if parsed, err := url.Parse(u); err == nil {
+		path = parsed.Path
+	}
+	if base, err := url.Parse(baseURL); err == nil {
+		if prefix := strings.TrimRight(base.Path, "/"); strings.HasPrefix(path, prefix+"/") {
+			path = strings.TrimPrefix(path, prefix)
+		}
+	}
+	switch {
+	case path == "/save" || strings.HasPrefix(path, "/save/"):
+		return EndpointCapture
+	case strings.HasPrefix(path, "/web/timemap/"):
+		return EndpointTimeMap
+	case strings.HasPrefix(path, "/cdx/"), strings.HasPrefix(path, "/__wb/"), strings.HasPrefix(path, "/wayback/"):
+		return EndpointCDX
+	default:
+		return EndpointContent
+	}
+}
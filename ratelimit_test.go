@@ -0,0 +1,156 @@
+package archiveorg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	testCases := map[string]float64{
+		"2":     2,
+		"2/s":   2,
+		"30/m":  0.5,
+		"36/h":  0.01,
+		" 0 ":   0,
+		"1/min": 1.0 / 60,
+	}
+	for input, expected := range testCases {
+		actual, err := ParseRate(input)
+		if err != nil {
+			t.Errorf("[input=%q] Unexpected error: %s", input, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("[input=%q] Expected %v but actual=%v", input, expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "fast", "1/d", "-1/s"} {
+		if _, err := ParseRate(input); err == nil {
+			t.Errorf("[input=%q] Expected error", input)
+		}
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(20, 1)
+
+	var (
+		wg    sync.WaitGroup
+		start = time.Now()
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The first request is immediate, the remaining 4 are spaced 50ms apart.
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Expected concurrent waits to be spread over >=200ms but took %s", elapsed)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := NewRateLimiter(1.0/60, 1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected err=%v but actual=%v", context.DeadlineExceeded, err)
+	}
+
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Wait(ctx); err != nil {
+		t.Errorf("Expected nil limiter to never block, but got %v", err)
+	}
+}
+
+func TestEndpointClassFor(t *testing.T) {
+	testCases := map[string]EndpointClass{
+		"https://web.archive.org/save":                                      EndpointCapture,
+		"https://web.archive.org/save/https://jaytaylor.com/":               EndpointCapture,
+		"https://web.archive.org/save/status/spn2-abc":                      EndpointCapture,
+		"https://web.archive.org/cdx/search/cdx?url=jaytaylor.com":          EndpointCDX,
+		"https://web.archive.org/__wb/sparkline?url=jaytaylor.com":          EndpointCDX,
+		"https://web.archive.org/wayback/available?url=jaytaylor.com":       EndpointCDX,
+		"https://web.archive.org/web/timemap/link/https://jaytaylor.com":    EndpointTimeMap,
+		"https://web.archive.org/web/20180326070330/https://jaytaylor.com/": EndpointContent,
+	}
+	for u, expected := range testCases {
+		if actual := endpointClassFor("https://web.archive.org", u); actual != expected {
+			t.Errorf("[url=%v] Expected class=%v but actual=%v", u, expected, actual)
+		}
+	}
+
+	// A BaseURL with a path prefix, e.g. a proxy.
+	testCases = map[string]EndpointClass{
+		"https://proxy.example.com/wayback/save":                                     EndpointCapture,
+		"https://proxy.example.com/wayback/cdx/search/cdx?url=jaytaylor.com":         EndpointCDX,
+		"https://proxy.example.com/wayback/web/timemap/link/https://jaytaylor.com":   EndpointTimeMap,
+		"https://proxy.example.com/wayback/web/20180326070330/https://jaytaylor.com": EndpointContent,
+	}
+	for u, expected := range testCases {
+		if actual := endpointClassFor("https://proxy.example.com/wayback/", u); actual != expected {
+			t.Errorf("[url=%v] Expected class=%v but actual=%v", u, expected, actual)
+		}
+	}
+}
+
+func TestRateLimitPrefixedBaseURL(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/wayback/web/timemap/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rawTimeMap))
+	}))
+	c.BaseURL += "/wayback"
+	c.RateLimits = map[EndpointClass]*RateLimiter{EndpointTimeMap: NewRateLimiter(10, 1)}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := c.TimeMap("jaytaylor.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Expected the TimeMap rate limit to apply below a prefixed BaseURL, but 3 requests took %s", elapsed)
+	}
+}
+
+func TestRateLimitsSharedByClients(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rawTimeMap))
+	}))
+	defer ts.Close()
+
+	defer func(limiter *RateLimiter) { RateLimits[EndpointTimeMap] = limiter }(RateLimits[EndpointTimeMap])
+	RateLimits[EndpointTimeMap] = NewRateLimiter(10, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c := NewClient()
+		c.BaseURL = ts.URL
+		c.HTTPHost = ""
+		if _, err := c.TimeMap("jaytaylor.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Expected separate clients to share the rate limit, but 3 requests took %s", elapsed)
+	}
+}
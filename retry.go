@@ -0,0 +1,142 @@
+package archiveorg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy decides which failed requests are retried, and how long to wait
+// in between.
+type RetryPolicy interface {
+	// Retryable reports whether the error of a failed attempt is transient.
+	Retryable(err error) bool
+
+	// NewBackOff returns a fresh delay schedule for a single request.  When
+	// it returns backoff.Stop the last error is returned to the caller.
+	NewBackOff() backoff.BackOff
+}
+
+// BackOffRetryPolicy is the default RetryPolicy.  It retries rate limited
+// (429), timed out (408) and server error (5xx) responses as well as transient
+// network errors, with exponential backoff.  A 'Retry-After' response header is
+// honored when it asks for a longer delay, unless waiting would exceed
+// MaxElapsedTime.
+type BackOffRetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	MaxElapsedTime  time.Duration // Total time budget for retries, 0 for no limit.
+}
+
+// NewRetryPolicy returns a BackOffRetryPolicy with sensible defaults.
+func NewRetryPolicy() *BackOffRetryPolicy {
+	policy := &BackOffRetryPolicy{
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		MaxElapsedTime:  2 * time.Minute,
+	}
+	return policy
+}
+
+// Retryable reports whether err is a 408, 429, 5xx or transient network error:
+// a timeout, a refused or reset connection or a truncated response.  Other
+// request failures, such as TLS verification errors or unsupported URL
+// schemes, are permanent.
+func (policy *BackOffRetryPolicy) Retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusRequestTimeout || httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode/100 == 5
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// NewBackOff returns an exponential backoff schedule.
+func (policy *BackOffRetryPolicy) NewBackOff() backoff.BackOff {
+	bk := backoff.NewExponentialBackOff()
+	bk.InitialInterval = policy.InitialInterval
+	bk.MaxInterval = policy.MaxInterval
+	bk.Multiplier = policy.Multiplier
+	bk.MaxElapsedTime = policy.MaxElapsedTime
+	bk.Reset()
+	return bk
+}
+
+// retry invokes op until it succeeds, fails with an error the client's
+// RetryPolicy does not consider transient, MaxTries is exhausted or ctx is
+// done.  Every attempt is subject to the rate limit for u.
+func (c *Client) retry(ctx context.Context, u string, op func() error) error {
+	return c.retryIf(ctx, u, nil, op)
+}
+
+// retryIf is like retry, but when retryable is non-nil an error is only
+// retried if retryable also accepts it.  Used for requests which are not
+// idempotent.
+func (c *Client) retryIf(ctx context.Context, u string, retryable func(error) bool, op func() error) error {
+	policy := c.RetryPolicy
+	if policy == nil {
+		policy = NewRetryPolicy()
+	}
+
+	var (
+		b0 = policy.NewBackOff()
+		bk = backoff.WithMaxRetries(b0, uint64(c.MaxTries))
+	)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.waitRateLimit(ctx, u); err != nil {
+			return err
+		}
+
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if c.MaxTries <= 0 || !policy.Retryable(err) || (retryable != nil && !retryable(err)) {
+			return err
+		}
+
+		d := bk.NextBackOff()
+		if d == backoff.Stop {
+			return err
+		}
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > d {
+			d = httpErr.RetryAfter
+			if eb, ok := b0.(*backoff.ExponentialBackOff); ok && eb.MaxElapsedTime > 0 && eb.GetElapsedTime()+d > eb.MaxElapsedTime {
+				return err
+			}
+		}
+
+		log.WithField("url", u).WithField("next-duration", d).Warnf("Retrying after: %s", err)
+
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package archiveorg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func fastRetryPolicy() *BackOffRetryPolicy {
+	policy := &BackOffRetryPolicy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		Multiplier:      1,
+		MaxElapsedTime:  5 * time.Second,
+	}
+	return policy
+}
+
+func TestRetryTransientTimeMap(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, rawTimeMap)
+		}
+	}))
+	c.RetryPolicy = fastRetryPolicy()
+
+	timemap, err := c.TimeMap("jaytaylor.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 3, requests; actual != expected {
+		t.Errorf("Expected %v requests but actual=%v", expected, actual)
+	}
+	if len(timemap.Mementos) == 0 {
+		t.Errorf("Expected mementos after retrying")
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		maxTries   int
+		expected   int
+	}{
+		{http.StatusForbidden, 10, 1},         // Not transient.
+		{http.StatusNotFound, 10, 1},          // Not transient.
+		{http.StatusServiceUnavailable, 3, 4}, // Initial attempt + MaxTries retries.
+		{http.StatusServiceUnavailable, 0, 1}, // Retries disabled.
+		{http.StatusTooManyRequests, 2, 3},
+	}
+
+	for i, testCase := range testCases {
+		requests := 0
+		c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(testCase.statusCode)
+		}))
+		c.MaxTries = testCase.maxTries
+		c.RetryPolicy = fastRetryPolicy()
+
+		_, err := c.Search("jaytaylor.com")
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != testCase.statusCode {
+			t.Errorf("[i=%v] Expected HTTPError with StatusCode=%v but got %v", i, testCase.statusCode, err)
+		}
+		if requests != testCase.expected {
+			t.Errorf("[i=%v] Expected %v requests but actual=%v", i, testCase.expected, requests)
+		}
+	}
+}
+
+func TestRetryAfterExceedsMaxElapsedTime(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	c.RetryPolicy = fastRetryPolicy()
+
+	start := time.Now()
+	_, err := c.TimeMap("jaytaylor.com")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected ErrRateLimited but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected to give up immediately rather than honor Retry-After, but took %s", elapsed)
+	}
+	if expected, actual := 1, requests; actual != expected {
+		t.Errorf("Expected %v requests but actual=%v", expected, actual)
+	}
+}
+
+func TestRetryCapture(t *testing.T) {
+	requests := 0
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Location", "/web/20180326070330/https://jaytaylor.com/")
+	}))
+	c.RetryPolicy = fastRetryPolicy()
+
+	start := time.Now()
+	if _, err := c.Capture("https://jaytaylor.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to be honored, but retried after %s", elapsed)
+	}
+	if expected, actual := 2, requests; actual != expected {
+		t.Errorf("Expected %v requests but actual=%v", expected, actual)
+	}
+}
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestRetryPermanentClientError(t *testing.T) {
+	transport := &countingTransport{}
+
+	c := NewClient()
+	c.BaseURL = "ftp://web.archive.org"
+	c.HTTPHost = ""
+	c.HTTPClient = &http.Client{Transport: transport}
+	c.RetryPolicy = fastRetryPolicy()
+
+	if _, err := c.TimeMap("jaytaylor.com"); err == nil {
+		t.Fatal("Expected an unsupported protocol scheme error")
+	}
+	if expected, actual := 1, transport.requests; actual != expected {
+		t.Errorf("Expected %v attempts but actual=%v", expected, actual)
+	}
+}
+
+func TestRetryableNetworkErrors(t *testing.T) {
+	policy := NewRetryPolicy()
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{&url.Error{Op: "Get", URL: "https://web.archive.org", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{&url.Error{Op: "Get", URL: "https://web.archive.org", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{&url.Error{Op: "Get", URL: "https://web.archive.org", Err: io.ErrUnexpectedEOF}, true},
+		{&url.Error{Op: "Get", URL: "https://web.archive.org", Err: errors.New("x509: certificate signed by unknown authority")}, false},
+		{&url.Error{Op: "Get", URL: "ftp://web.archive.org", Err: errors.New("unsupported protocol scheme \"ftp\"")}, false},
+	}
+	for i, testCase := range testCases {
+		if actual := policy.Retryable(testCase.err); actual != testCase.expected {
+			t.Errorf("[i=%v] Expected Retryable(%v)=%v but actual=%v", i, testCase.err, testCase.expected, actual)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package archiveorg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,7 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/cenkalti/backoff"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -22,6 +22,8 @@ var (
 	UserAgent             = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_9_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/65.0.3325.162 Safari/537.36" // Overrideable default package value.
 	DefaultRequestTimeout = 10 * time.Second                                                                                                           // Overrideable default package value.
 	MaxTries              = 10                                                                                                                         // Max number download retries before giving up.
+	AccessKey             = ""                                                                                                                         // archive.org S3-style access key, enables Save Page Now 2 captures.
+	SecretKey             = ""                                                                                                                         // archive.org S3-style secret key.
 )
 
 // Snapshot represents an instance of a URL page snapshot on archive.is.
@@ -32,18 +34,38 @@ type Snapshot struct {
 	Timestamp  time.Time
 }
 
-// Search for URL snapshots.
+// Search for URL snapshots using the package-level default client settings.
 func Search(u string, timeout ...time.Duration) ([]Snapshot, error) {
-	if len(timeout) == 0 {
-		timeout = []time.Duration{DefaultRequestTimeout}
+	return defaultClient(timeout...).Search(u)
+}
+
+// SearchContext is like Search but aborts when ctx is done.
+func SearchContext(ctx context.Context, u string, timeout ...time.Duration) ([]Snapshot, error) {
+	return defaultClient(timeout...).SearchContext(ctx, u)
+}
+
+// Search for URL snapshots.
+//
+// Unlike Closest and TimeMap, a URL which was never archived is not an error:
+// Search returns an empty slice and a nil error, since "no snapshots" is a
+// valid search result.  Check len(snapshots) == 0 rather than ErrNotArchived.
+func (c *Client) Search(u string) ([]Snapshot, error) {
+	return c.SearchContext(context.Background(), u)
+}
+
+// SearchContext searches for URL snapshots, aborting in-flight requests and
+// retry sleeps when ctx is done.
+func (c *Client) SearchContext(ctx context.Context, u string) ([]Snapshot, error) {
+	if c.LocalIndex != nil {
+		return c.searchLocalIndex(u)
 	}
 
-	sl, err := sparklineFor(u, timeout[0])
+	sl, err := c.sparklineFor(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
-	points, err := sl.captures()
+	points, err := sl.captures(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -54,12 +76,12 @@ func Search(u string, timeout ...time.Duration) ([]Snapshot, error) {
 		for i := 0; i < point.Count; i++ {
 			if i >= len(point.Timestamps) {
 				// Invalid offset, skip entry.
-				continue
 				log.WithField("url", u).Warn("Skipping point with missing timestamp")
+				continue
 			}
 
 			snap := Snapshot{
-				URL: fmt.Sprintf("%v/web/%v/%v", BaseURL, point.Timestamps[i], u),
+				URL: fmt.Sprintf("%v/web/%v/%v", c.BaseURL, point.Timestamps[i], u),
 			}
 
 			if ts, err := time.Parse(timestampLayout, fmt.Sprint(point.Timestamps[i])); err != nil {
@@ -88,6 +110,25 @@ func Search(u string, timeout ...time.Duration) ([]Snapshot, error) {
 	return snaps, nil
 }
 
+// searchLocalIndex answers Search from c.LocalIndex, newest first.
+func (c *Client) searchLocalIndex(u string) ([]Snapshot, error) {
+	records, err := c.LocalIndex.Search(CDXQuery{URL: u})
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]Snapshot, 0, len(records))
+	for _, record := range records {
+		snaps = append(snaps, c.cdxSnapshot(record))
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Timestamp.After(snaps[j].Timestamp)
+	})
+
+	return snaps, nil
+}
+
 type calendarPoint struct {
 	Count       int           `json:"cnt"`
 	Whys        [][]string    `json:"why"`
@@ -100,13 +141,16 @@ func (point calendarPoint) isEmpty() bool {
 	return empty
 }
 
-func calendarFor(u string, timeout time.Duration) ([]calendarPoint, error) {
-	sl, err := sparklineFor(u, timeout)
+func (c *Client) calendarFor(ctx context.Context, u string) ([]calendarPoint, error) {
+	sl, err := c.sparklineFor(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
-	captures, err := sl.captures()
+	captures, err := sl.captures(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	return captures, nil
 }
@@ -116,10 +160,10 @@ type sparkline struct {
 	LastTs  string        `json:"last_ts"`
 	Years   map[int][]int `json:"years"`
 	safeURL string        `json:"-"`
-	timeout time.Duration `json:"-"`
+	client  *Client       `json:"-"`
 }
 
-func (sl *sparkline) captures() ([]calendarPoint, error) {
+func (sl *sparkline) captures(ctx context.Context) ([]calendarPoint, error) {
 	var (
 		points = []calendarPoint{}
 	)
@@ -129,11 +173,11 @@ func (sl *sparkline) captures() ([]calendarPoint, error) {
 			// Capture each year with a non-empty crawl count month.
 			if count > 0 {
 				var (
-					queryURL = fmt.Sprintf("%v/__wb/calendarcaptures?url=%v&selected_year=%v", BaseURL, sl.safeURL, year)
+					queryURL = fmt.Sprintf("%v/__wb/calendarcaptures?url=%v&selected_year=%v", sl.client.BaseURL, sl.safeURL, year)
 					captures = [][][]*calendarPoint{}
 				)
 
-				if _, err := simpleHTTPJSON(queryURL, &captures, sl.timeout); err != nil {
+				if _, err := sl.client.simpleHTTPJSON(ctx, queryURL, &captures); err != nil {
 					return nil, err
 				}
 
@@ -158,48 +202,34 @@ func (sl *sparkline) captures() ([]calendarPoint, error) {
 	return points, nil
 }
 
-func sparklineFor(u string, timeout time.Duration) (*sparkline, error) {
+func (c *Client) sparklineFor(ctx context.Context, u string) (*sparkline, error) {
 	safe := url.PathEscape(u)
-	queryURL := fmt.Sprintf("%v/__wb/sparkline?url=%v&collection=web&output=json", BaseURL, safe)
+	queryURL := fmt.Sprintf("%v/__wb/sparkline?url=%v&collection=web&output=json", c.BaseURL, safe)
 	sl := &sparkline{}
-	if _, err := simpleHTTPJSON(queryURL, sl, timeout); err != nil {
+	if _, err := c.simpleHTTPJSON(ctx, queryURL, sl); err != nil {
 		return nil, err
 	}
 	sl.safeURL = safe
-	sl.timeout = timeout
+	sl.client = c
 	return sl, nil
 }
 
 // simpleHTTPJSON deserializes response body content from get request url into
-// objPtr.  Includes backoff logic.
-func simpleHTTPJSON(u string, objPtr interface{}, timeout time.Duration) (*http.Response, error) {
+// objPtr.  Transient failures are retried according to the client's
+// RetryPolicy, which is abandoned as soon as ctx is done.
+func (c *Client) simpleHTTPJSON(ctx context.Context, u string, objPtr interface{}) (*http.Response, error) {
 	var (
-		resp               *http.Response
-		body               []byte
-		b0, disableBackOff = newBackOff()
-		bk                 = backoff.WithMaxRetries(b0, uint64(MaxTries))
+		resp *http.Response
+		body []byte
 	)
 
-	notify := func(err error, d time.Duration) {
-		log.WithField("url", u).WithField("next-duration", d).Warnf("Backoff notified about: %s", err)
-	}
-
-	op := func() error {
+	err := c.retry(ctx, u, func() error {
 		log.WithField("url", u).Debug("Downloading JSON data")
 		var err error
-		if resp, body, err = doRequest("", u, nil, timeout); err != nil {
-			if resp != nil && resp.StatusCode != 403 {
-				// Stop retrying when there's an error and the HTTP status code
-				//is not 403
-				log.WithField("url", u).Warnf("Disabling backoff due to non-403 HTTP return status code=%v", resp.StatusCode)
-				disableBackOff()
-			}
-			return err
-		}
-		return nil
-	}
-
-	if err := backoff.RetryNotify(op, bk, notify); err != nil {
+		resp, body, err = c.doRequest(ctx, "", u, nil)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 	if err := json.Unmarshal(body, objPtr); err != nil {
@@ -207,18 +237,3 @@ func simpleHTTPJSON(u string, objPtr interface{}, timeout time.Duration) (*http.
 	}
 	return resp, nil
 }
-
-func newBackOff() (backoff.BackOff, func()) {
-	bk := backoff.NewExponentialBackOff()
-
-	disabler := func() {
-		bk.Multiplier = 0.0
-		bk.MaxInterval = time.Duration(1)
-	}
-
-	bk.InitialInterval = 30 * time.Second
-	bk.Multiplier = 1.5
-	bk.MaxInterval = 60 * time.Second
-
-	return bk, disabler
-}
@@ -0,0 +1,66 @@
+package archiveorg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSearchContextCancelAbortsBackOff(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 503 triggers the retry backoff.
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	c.RetryPolicy = &BackOffRetryPolicy{InitialInterval: time.Minute, MaxInterval: time.Minute, Multiplier: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := c.SearchContext(ctx, "https://jaytaylor.com/")
+	if err != context.Canceled {
+		t.Errorf("Expected err=%v but actual=%v", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected search to abort promptly after context cancellation, but took %s", elapsed)
+	}
+}
+
+func TestCalendarForError(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/__wb/sparkline":
+			fmt.Fprint(w, `{"first_ts":"20180101000000","last_ts":"20180101000000","years":{"2018":[1,0,0,0,0,0,0,0,0,0,0,0]}}`)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+
+	if _, err := c.calendarFor(context.Background(), "https://jaytaylor.com/"); err == nil {
+		t.Errorf("Expected calendar capture errors to be returned")
+	}
+}
+
+func TestSearchNotArchived(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/__wb/sparkline":
+			fmt.Fprint(w, `{"first_ts":null,"last_ts":null,"years":{}}`)
+		default:
+			t.Errorf("Unexpected request for %v", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+
+	// Unlike Closest and TimeMap, Search reports no captures as an empty
+	// result rather than ErrNotArchived.
+	snaps, err := c.Search("https://jaytaylor.com/never")
+	if err != nil {
+		t.Fatalf("Expected no error but actual=%v", err)
+	}
+	if snaps == nil || len(snaps) != 0 {
+		t.Errorf("Expected an empty, non-nil result but actual=%#v", snaps)
+	}
+}
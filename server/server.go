@@ -0,0 +1,555 @@
+// Package server implements a Wayback Machine compatible replay server backed
+// by a local CDX index and the WARC/ARC files it references.
+//
+// Supported endpoints:
+//
+//	/cdx/search/cdx                   CDX Server API
+//	/wayback/available                Availability API
+//	/web/timemap/{link,json,cdxj}/URL TimeMaps
+//	/web/TIMESTAMP[MODIFIER]/URL      Mementos, redirecting to the closest capture
+//	/web/URL                          TimeGate (honors Accept-Datetime)
+//
+// Archived content is served as captured, without URL rewriting or a toolbar,
+// with the original headers repeated as X-Archive-Orig-* headers.
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"jaytaylor.com/archive.org"
+)
+
+const timestampLayout = "20060102150405"
+
+// defaultCDXFields is the field list of CDX server output when fl is not
+// given.
+var defaultCDXFields = []string{"urlkey", "timestamp", "original", "mimetype", "statuscode", "digest", "length"}
+
+// replayExpr matches the remainder of a /web/ path: a (possibly truncated)
+// timestamp, optional modifier and the archived URL.
+var replayExpr = regexp.MustCompile(`^([0-9]{1,14})([a-z]{2}_)?/(.+)$`)
+
+// Server serves a Wayback Machine compatible API.  Point a
+// archiveorg.Client's BaseURL at it to use archived content offline.
+type Server struct {
+	Index   *archiveorg.CDXIndex
+	Files   http.FileSystem // WARC and ARC files, opened by their CDX filename.
+	BaseURL string          // Base URL used in generated links; defaults to the request's scheme and host.
+}
+
+// New returns a Server for index, reading captures from files.
+func New(index *archiveorg.CDXIndex, files http.FileSystem) *Server {
+	s := &Server{
+		Index: index,
+		Files: files,
+	}
+	return s
+}
+
+// ServeHTTP dispatches on the raw request path, since http.ServeMux would
+// clean the "//" of archived URLs such as /web/2018/https://example.com/.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/cdx/search/cdx":
+		s.serveCDX(w, r)
+	case path == "/wayback/available":
+		s.serveAvailable(w, r)
+	case strings.HasPrefix(path, "/web/timemap/"):
+		s.serveTimeMap(w, r, strings.TrimPrefix(path, "/web/timemap/"))
+	case strings.HasPrefix(path, "/web/"):
+		s.serveReplay(w, r, strings.TrimPrefix(path, "/web/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveCDX answers CDX Server API queries, in JSON when output=json and as
+// space separated lines otherwise.
+func (s *Server) serveCDX(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query()
+
+	q, err := cdxQuery(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonOutput := v.Get("output") == "json"
+
+	if v.Get("showNumPages") == "true" {
+		// The whole index is always a single page.
+		if jsonOutput {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		fmt.Fprintln(w, 1)
+		return
+	}
+
+	records, resumeKey, err := s.Index.Batch(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = defaultCDXFields
+	}
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, cdxRow(record, fields))
+	}
+
+	if jsonOutput {
+		out := [][]string{}
+		if len(rows) > 0 {
+			out = append(append(out, fields), rows...)
+		}
+		if resumeKey != "" {
+			out = append(out, []string{}, []string{resumeKey})
+		}
+		writeJSON(w, out)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, " "))
+	}
+	if resumeKey != "" {
+		fmt.Fprintf(w, "\n%v\n", resumeKey)
+	}
+}
+
+// cdxRow returns the values of fields for record, with "-" for missing
+// values as in the CDX server's output.
+func cdxRow(record archiveorg.CDXRecord, fields []string) []string {
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		if row[i] = record.Field(field); row[i] == "" {
+			row[i] = "-"
+		}
+	}
+	return row
+}
+
+// cdxQuery converts CDX server URL parameters to a query.
+func cdxQuery(v url.Values) (archiveorg.CDXQuery, error) {
+	q := archiveorg.CDXQuery{
+		URL:           v.Get("url"),
+		MatchType:     archiveorg.MatchType(v.Get("matchType")),
+		Filters:       v["filter"],
+		Collapse:      v["collapse"],
+		ShowResumeKey: v.Get("showResumeKey") == "true",
+		ResumeKey:     v.Get("resumeKey"),
+	}
+	if q.URL == "" {
+		return q, fmt.Errorf("missing url parameter")
+	}
+
+	var err error
+	if from := v.Get("from"); from != "" {
+		if q.From, err = archiveorg.ParseTimestamp(from); err != nil {
+			return q, err
+		}
+	}
+	if to := v.Get("to"); to != "" {
+		if _, q.To, err = archiveorg.ParseTimestampRange(to); err != nil {
+			return q, err
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset, "page": &q.Page, "pageSize": &q.PageSize} {
+		if value := v.Get(name); value != "" {
+			if *dst, err = strconv.Atoi(value); err != nil {
+				return q, fmt.Errorf("invalid %v parameter %q", name, value)
+			}
+		}
+	}
+	if fl := v.Get("fl"); fl != "" {
+		q.Fields = strings.Split(fl, ",")
+	}
+	if closest := v.Get("closest"); closest != "" && v.Get("sort") == "closest" {
+		if q.Closest, err = archiveorg.ParseTimestamp(closest); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// serveAvailable answers Availability API queries with the successful capture
+// closest to the requested timestamp (default now).
+func (s *Server) serveAvailable(w http.ResponseWriter, r *http.Request) {
+	var (
+		v      = r.URL.Query()
+		target = v.Get("url")
+		at     = time.Now()
+		result = map[string]interface{}{
+			"url":                target,
+			"archived_snapshots": map[string]interface{}{},
+		}
+	)
+	if target == "" {
+		http.Error(w, "missing url parameter", http.StatusBadRequest)
+		return
+	}
+	if timestamp := v.Get("timestamp"); timestamp != "" {
+		var err error
+		if at, err = archiveorg.ParseTimestamp(timestamp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := s.Index.Search(archiveorg.CDXQuery{URL: target, Filters: []string{"statuscode:[23]..|-"}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if i := closest(records, at); i >= 0 {
+		record := records[i]
+		result["archived_snapshots"] = map[string]interface{}{
+			"closest": map[string]interface{}{
+				"status":    record.Field("statuscode"),
+				"available": true,
+				"url":       s.mementoURL(r, record.Timestamp, "", record.Original),
+				"timestamp": record.Field("timestamp"),
+			},
+		}
+	}
+	writeJSON(w, result)
+}
+
+// serveTimeMap serves rest, "<format>/<url>", as a TimeMap.
+func (s *Server) serveTimeMap(w http.ResponseWriter, r *http.Request, rest string) {
+	pieces := strings.SplitN(rest, "/", 2)
+	if len(pieces) != 2 || pieces[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	format, target := archiveorg.TimeMapFormat(pieces[0]), archivedURL(pieces[1], r.URL.RawQuery)
+
+	records, err := s.Index.Search(archiveorg.CDXQuery{URL: target})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(records) == 0 {
+		http.Error(w, "not archived", http.StatusNotFound)
+		return
+	}
+
+	switch format {
+	case archiveorg.TimeMapLinkFormat:
+		w.Header().Set("Content-Type", "application/link-format")
+		if err := s.timeMap(r, target, records).WriteLinkFormat(w); err != nil {
+			log.WithField("url", target).Errorf("Writing TimeMap: %s", err)
+		}
+
+	case archiveorg.TimeMapJSONFormat:
+		rows := [][]string{defaultCDXFields}
+		for _, record := range records {
+			rows = append(rows, cdxRow(record, defaultCDXFields))
+		}
+		writeJSON(w, rows)
+
+	case archiveorg.TimeMapCDXJFormat:
+		w.Header().Set("Content-Type", "text/x-cdxj")
+		if err := archiveorg.WriteCDXJ(w, records); err != nil {
+			log.WithField("url", target).Errorf("Writing TimeMap: %s", err)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// timeMap builds the link-format TimeMap of records, which must be sorted
+// chronologically.
+func (s *Server) timeMap(r *http.Request, target string, records []archiveorg.CDXRecord) *archiveorg.TimeMap {
+	var (
+		linkFormat = "application/link-format"
+		first      = records[0].Timestamp
+		last       = records[len(records)-1].Timestamp
+		timemap    = archiveorg.NewTimeMap()
+	)
+	timemap.Original = &archiveorg.Memento{URL: records[0].Original, Rel: "original"}
+	timemap.Self = &archiveorg.Memento{URL: s.baseURL(r) + "/web/timemap/link/" + target, Rel: "self", Type: &linkFormat, From: &first, Until: &last}
+	timemap.TimeGate = &archiveorg.Memento{URL: s.baseURL(r) + "/web/" + target, Rel: "timegate"}
+	for i, record := range records {
+		ts := record.Timestamp
+		m := archiveorg.Memento{
+			URL:  s.mementoURL(r, ts, "", record.Original),
+			Rel:  "memento",
+			Time: &ts,
+		}
+		switch {
+		case len(records) == 1:
+			m.Rel = "first last memento"
+		case i == 0:
+			m.Rel = "first memento"
+		case i == len(records)-1:
+			m.Rel = "last memento"
+		}
+		timemap.Mementos = append(timemap.Mementos, m)
+	}
+	timemap.Reindex()
+	return timemap
+}
+
+// serveReplay serves rest, "<timestamp>[<modifier>]/<url>" or a bare "<url>"
+// for TimeGate negotiation.
+func (s *Server) serveReplay(w http.ResponseWriter, r *http.Request, rest string) {
+	var (
+		timestamp string
+		modifier  string
+		target    string
+		at        time.Time
+		err       error
+	)
+	if m := replayExpr.FindStringSubmatch(rest); m != nil {
+		timestamp, modifier, target = m[1], m[2], archivedURL(m[3], r.URL.RawQuery)
+		if at, err = archiveorg.ParseTimestamp(timestamp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		target = archivedURL(rest, r.URL.RawQuery)
+		at = time.Now()
+		if acceptDatetime := r.Header.Get("Accept-Datetime"); acceptDatetime != "" {
+			if at, err = http.ParseTime(acceptDatetime); err != nil {
+				http.Error(w, fmt.Sprintf("invalid Accept-Datetime %q", acceptDatetime), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	records, err := s.Index.Search(archiveorg.CDXQuery{URL: target})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current := closest(records, at)
+	if current < 0 {
+		http.Error(w, "not archived", http.StatusNotFound)
+		return
+	}
+	record := records[current]
+
+	if timestamp == "" {
+		// TimeGate: redirect to the negotiated memento.
+		w.Header().Set("Vary", "accept-datetime")
+		w.Header().Set("Link", s.linkHeader(r, target, records, current))
+		http.Redirect(w, r, s.mementoURL(r, record.Timestamp, "", record.Original), http.StatusFound)
+		return
+	}
+	if ts := record.Timestamp.Format(timestampLayout); ts != timestamp {
+		http.Redirect(w, r, s.mementoURL(r, record.Timestamp, modifier, record.Original), http.StatusFound)
+		return
+	}
+
+	resp, err := s.capture(record, records)
+	if err != nil {
+		log.WithField("url", target).WithField("timestamp", timestamp).Errorf("Loading capture: %s", err)
+		http.Error(w, "error loading capture", http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	header := w.Header()
+	for name, values := range resp.Header {
+		for _, value := range values {
+			header.Add("X-Archive-Orig-"+name, value)
+		}
+	}
+	for _, name := range []string{"Content-Type", "Content-Encoding"} {
+		if value := resp.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	if location := resp.Header.Get("Location"); location != "" && resp.StatusCode/100 == 3 {
+		if ref, err := url.Parse(record.Original); err == nil {
+			if loc, err := ref.Parse(location); err == nil {
+				header.Set("Location", s.mementoURL(r, record.Timestamp, modifier, loc.String()))
+			}
+		}
+	}
+	header.Set("Memento-Datetime", record.Timestamp.UTC().Format(http.TimeFormat))
+	header.Set("Link", s.linkHeader(r, target, records, current))
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != "HEAD" {
+		io.Copy(w, resp.Body)
+	}
+}
+
+// linkHeader returns the Memento Link header for target: the original,
+// TimeGate and TimeMap plus the first, last, previous and next mementos
+// relative to records[current].
+func (s *Server) linkHeader(r *http.Request, target string, records []archiveorg.CDXRecord, current int) string {
+	timemap := s.timeMap(r, target, records)
+	timemap.Self.Rel = "timemap"
+
+	mementos := []archiveorg.Memento{}
+	for i, m := range timemap.Mementos {
+		rels := []string{}
+		if i == 0 {
+			rels = append(rels, "first")
+		}
+		if i == len(records)-1 {
+			rels = append(rels, "last")
+		}
+		if i == current-1 {
+			rels = append(rels, "prev")
+		}
+		if i == current+1 {
+			rels = append(rels, "next")
+		}
+		if len(rels) == 0 && i != current {
+			continue
+		}
+		m.Rel = strings.Join(append(rels, "memento"), " ")
+		mementos = append(mementos, m)
+	}
+	timemap.Mementos = mementos
+
+	var buf bytes.Buffer
+	timemap.WriteLinkFormat(&buf)
+	return strings.Replace(strings.TrimSpace(buf.String()), ",\n", ", ", -1)
+}
+
+// capture loads the archived HTTP response of record, following revisit
+// records to the most recent earlier capture with the same digest.
+func (s *Server) capture(record archiveorg.CDXRecord, records []archiveorg.CDXRecord) (*http.Response, error) {
+	if record.MimeType == "warc/revisit" {
+		var original *archiveorg.CDXRecord
+		for i := range records {
+			candidate := &records[i]
+			if candidate.Digest != record.Digest || candidate.MimeType == "warc/revisit" || candidate.Timestamp.After(record.Timestamp) {
+				continue
+			}
+			if original == nil || !candidate.Timestamp.Before(original.Timestamp) {
+				original = candidate
+			}
+		}
+		if original == nil {
+			return nil, fmt.Errorf("no original capture found for revisit of %v with digest %v", record.Original, record.Digest)
+		}
+		record = *original
+	}
+	if record.Filename == "" {
+		return nil, fmt.Errorf("no WARC filename for capture of %v", record.Original)
+	}
+
+	f, err := s.Files.Open(record.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(record.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = f
+	if record.Length > 0 {
+		r = io.LimitReader(f, record.Length)
+	}
+	wr, err := archiveorg.NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := wr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading %v at offset %v: %s", record.Filename, record.Offset, err)
+	}
+
+	if rec.Type == archiveorg.WARCResource {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {rec.ContentType}},
+			Body:       ioutil.NopCloser(bytes.NewReader(rec.Block)),
+		}
+		return resp, nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTTP response in %v at offset %v: %s", record.Filename, record.Offset, err)
+	}
+	// The body is re-framed when served.
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Transfer-Encoding")
+	return resp, nil
+}
+
+func (s *Server) baseURL(r *http.Request) string {
+	if s.BaseURL != "" {
+		return strings.TrimRight(s.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) mementoURL(r *http.Request, ts time.Time, modifier string, u string) string {
+	return fmt.Sprintf("%v/web/%v%v/%v", s.baseURL(r), ts.UTC().Format(timestampLayout), modifier, u)
+}
+
+// closest returns the index of the record nearest to t as chosen by
+// TimeMap.Nearest, or -1 when there are no records.
+func closest(records []archiveorg.CDXRecord, t time.Time) int {
+	timemap := archiveorg.NewTimeMap()
+	for _, record := range records {
+		ts := record.Timestamp
+		timemap.Mementos = append(timemap.Mementos, archiveorg.Memento{Time: &ts})
+	}
+	timemap.Reindex()
+
+	nearest := timemap.Nearest(t)
+	for i := range timemap.Mementos {
+		if &timemap.Mementos[i] == nearest {
+			return i
+		}
+	}
+	return -1
+}
+
+// archivedURL restores the archived URL from a request path remainder and
+// query string, undoing the collapse of "http://" to "http:/" done by some
+// clients and proxies.
+func archivedURL(u string, rawQuery string) string {
+	for _, scheme := range []string{"http:/", "https:/"} {
+		if strings.HasPrefix(u, scheme) && !strings.HasPrefix(u, scheme+"/") {
+			u = scheme + "/" + strings.TrimPrefix(u, scheme)
+		}
+	}
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Writing JSON response: %s", err)
+	}
+}
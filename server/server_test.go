@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"jaytaylor.com/archive.org"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, func()) {
+	return serveWARC(t, []*archiveorg.WARCRecord{
+		{
+			Type:        archiveorg.WARCResponse,
+			Date:        time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Fields:      []archiveorg.WARCField{{Name: "WARC-Payload-Digest", Value: "sha1:V1"}},
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 2\r\n\r\nv1"),
+		},
+		{
+			Type:        archiveorg.WARCRevisit,
+			Date:        time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Fields:      []archiveorg.WARCField{{Name: "WARC-Payload-Digest", Value: "sha1:V1"}},
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n"),
+		},
+		{
+			Type:        archiveorg.WARCResponse,
+			Date:        time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 2\r\n\r\nv2"),
+		},
+		{
+			Type:        archiveorg.WARCResponse,
+			Date:        time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/old",
+			ContentType: "application/http;msgtype=response",
+			Block:       []byte("HTTP/1.1 301 Moved Permanently\r\nLocation: /\r\nContent-Length: 0\r\n\r\n"),
+		},
+	})
+}
+
+// serveWARC starts a Server for a gzipped WARC file holding records.
+func serveWARC(t *testing.T, records []*archiveorg.WARCRecord) (*httptest.Server, func()) {
+	dir, err := ioutil.TempDir("", "archiveorg-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "test.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ww := archiveorg.NewWARCWriter(f, true)
+	for _, rec := range records {
+		if err := ww.WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	f, err = os.Open(filepath.Join(dir, "test.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	index, err := archiveorg.IndexWARC(f, "test.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(New(archiveorg.NewCDXIndex(index...), http.Dir(dir)))
+	cleanup := func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+	return ts, cleanup
+}
+
+func TestServer(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	c := archiveorg.NewClient()
+	c.BaseURL = ts.URL
+	c.HTTPHost = ""
+	c.MaxTries = 0
+
+	const u = "https://jaytaylor.com/"
+
+	timemap, err := c.TimeMap(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 3, len(timemap.Mementos); actual != expected {
+		t.Errorf("Expected %v mementos but actual=%v", expected, actual)
+	}
+	if timemap.Original == nil || timemap.Original.URL != u {
+		t.Errorf("Expected original=%v but actual=%+v", u, timemap.Original)
+	}
+
+	var n int
+	it := c.CDXIterator(context.Background(), archiveorg.CDXQuery{URL: "jaytaylor.com", MatchType: archiveorg.MatchPrefix, Limit: 1})
+	for it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 4, n; actual != expected {
+		t.Errorf("Expected %v CDX records but actual=%v", expected, actual)
+	}
+
+	snap, err := c.Closest(u, time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ts.URL+"/web/20180101000000/"+u, snap.URL; actual != expected {
+		t.Errorf("Expected closest=%v but actual=%v", expected, actual)
+	}
+
+	// The revisit is replayed from the 2017 capture, after a redirect to the
+	// closest timestamp.
+	content, err := c.FetchSnapshot(u, time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), archiveorg.ModifierIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content.Body) != "v1" || content.Header.Get("Content-Type") != "text/html" || !content.Timestamp.Equal(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected content: %+v body=%q", content, content.Body)
+	}
+
+	// Archived redirects are followed within the archive.
+	content, err = c.FetchSnapshot(u+"old", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), archiveorg.ModifierIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := ts.URL+"/web/20180101000000id_/"+u, content.URL; actual != expected {
+		t.Errorf("Expected redirect to %v but actual=%v", expected, actual)
+	}
+
+	nm, err := c.NegotiateMemento(u, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nm.Time.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)) || nm.Original == nil || nm.Prev == nil || nm.First == nil || nm.TimeMap == nil {
+		t.Errorf("Unexpected negotiated memento: %+v", nm)
+	}
+
+	if _, err := c.TimeMap("https://example.com/"); !errors.Is(err, archiveorg.ErrNotArchived) {
+		t.Errorf("Expected ErrNotArchived but actual=%v", err)
+	}
+}
+
+func TestTruncatedTimestamp(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	// Odd length timestamps are padded the same way archiveorg.ParseTimestamp
+	// pads them, i.e. 2018010 means 2018-01-01.
+	resp, err := client.Get(ts.URL + "/web/2018010id_/https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if expected, actual := ts.URL+"/web/20180101000000id_/https://jaytaylor.com/", resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || actual != expected {
+		t.Errorf("Expected redirect to %v but actual=%v %v", expected, resp.StatusCode, actual)
+	}
+}
+
+func TestRevisitBetweenOriginals(t *testing.T) {
+	response := func(date time.Time, body string) *archiveorg.WARCRecord {
+		rec := &archiveorg.WARCRecord{
+			Type:        archiveorg.WARCResponse,
+			Date:        date,
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Fields:      []archiveorg.WARCField{{Name: "WARC-Payload-Digest", Value: "sha1:SAME"}},
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body),
+		}
+		return rec
+	}
+	revisit := response(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), "")
+	revisit.Type = archiveorg.WARCRevisit
+
+	ts, cleanup := serveWARC(t, []*archiveorg.WARCRecord{
+		response(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), "oldest"),
+		response(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), "older"),
+		revisit,
+		response(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), "newer"),
+	})
+	defer cleanup()
+
+	c := archiveorg.NewClient()
+	c.BaseURL = ts.URL
+	c.HTTPHost = ""
+	c.MaxTries = 0
+
+	content, err := c.FetchSnapshot("https://jaytaylor.com/", time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), archiveorg.ModifierIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "older", string(content.Body); actual != expected {
+		t.Errorf("Expected revisit to replay %q but actual=%q", expected, actual)
+	}
+}
+
+func TestTimeMapJSONMissingFields(t *testing.T) {
+	const cdx = ` CDX N b a m s k r M S V g
+com,jaytaylor)/ 20180101000000 https://jaytaylor.com/ warc/revisit - - - - - 0 a.warc.gz
+`
+	index, err := archiveorg.LoadCDXIndex(strings.NewReader(cdx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New(index, http.Dir(os.TempDir())))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/web/timemap/json/https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var rows [][]string
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected a header and one capture but actual=%v", rows)
+	}
+	for i, field := range rows[0] {
+		switch field {
+		case "statuscode", "digest", "length":
+			if value := rows[1][i]; value != "-" {
+				t.Errorf("Expected missing %v to be \"-\", as in CDX output, but actual=%q", field, value)
+			}
+		}
+	}
+}
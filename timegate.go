@@ -0,0 +1,147 @@
+package archiveorg
+
+// Memento datetime negotiation as described in RFC 7089 section 4.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NegotiatedMemento is the result of datetime negotiation with a TimeGate: the
+// selected memento along with the related resources advertised in its Link
+// header.
+type NegotiatedMemento struct {
+	Memento
+	Original *Memento
+	TimeGate *Memento
+	TimeMap  *Memento
+	First    *Memento
+	Prev     *Memento
+	Next     *Memento
+	Last     *Memento
+}
+
+// NegotiateMemento finds the memento of u closest to t via datetime negotiation,
+// using the package-level default client settings.
+func NegotiateMemento(u string, t time.Time, timeout ...time.Duration) (*NegotiatedMemento, error) {
+	return defaultClient(timeout...).NegotiateMemento(u, t)
+}
+
+// NegotiateMemento finds the memento of u closest to t via datetime
+// negotiation with the Wayback Machine TimeGate.
+func (c *Client) NegotiateMemento(u string, t time.Time) (*NegotiatedMemento, error) {
+	return c.NegotiateMementoContext(context.Background(), u, t)
+}
+
+// NegotiateMementoContext is like NegotiateMemento but aborts when ctx is done.
+func (c *Client) NegotiateMementoContext(ctx context.Context, u string, t time.Time) (*NegotiatedMemento, error) {
+	return c.NegotiateTimeGateContext(ctx, fmt.Sprintf("%v/web/%v", c.BaseURL, u), t)
+}
+
+// NegotiateTimeGate performs datetime negotiation against the TimeGate URI-G,
+// e.g. the value returned by TimeMap.TimeGateURL.
+func (c *Client) NegotiateTimeGate(timegateURL string, t time.Time) (*NegotiatedMemento, error) {
+	return c.NegotiateTimeGateContext(context.Background(), timegateURL, t)
+}
+
+// NegotiateTimeGateContext is like NegotiateTimeGate but aborts when ctx is
+// done.
+func (c *Client) NegotiateTimeGateContext(ctx context.Context, timegateURL string, t time.Time) (*NegotiatedMemento, error) {
+	acceptDatetime := t.UTC().Format(http.TimeFormat)
+
+	log.WithField("timegate", timegateURL).WithField("accept-datetime", acceptDatetime).Debug("Negotiating memento")
+
+	var resp *http.Response
+	err := c.retry(ctx, timegateURL, func() error {
+		req, err := c.newRequest(ctx, "GET", timegateURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept-Datetime", acceptDatetime)
+
+		// Redirects to the selected memento are followed by the HTTP client.
+		if resp, err = c.httpClient().Do(req); err != nil {
+			return fmt.Errorf("executing request to %v: %w", timegateURL, err)
+		}
+		if resp.StatusCode/100 != 2 {
+			err := newHTTPError(resp)
+			resp.Body.Close()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseNegotiatedMemento(resp)
+}
+
+// parseNegotiatedMemento extracts the memento described by the Link and
+// Memento-Datetime headers of resp.
+func parseNegotiatedMemento(resp *http.Response) (*NegotiatedMemento, error) {
+	datetime := resp.Header.Get("Memento-Datetime")
+	if datetime == "" {
+		return nil, fmt.Errorf("%s: missing 'Memento-Datetime' header", MementoParseErr)
+	}
+	ts, err := time.Parse(mementoLayout, datetime)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid 'Memento-Datetime' header %q", MementoParseErr, datetime)
+	}
+
+	nm := &NegotiatedMemento{
+		Memento: Memento{
+			URL:  resp.Request.URL.String(),
+			Rel:  "memento",
+			Time: &ts,
+		},
+	}
+
+	links, err := ParseLinkHeader(strings.Join(resp.Header["Link"], ", "))
+	if err != nil {
+		return nil, fmt.Errorf("%s: in Link header", err)
+	}
+	for _, m := range links {
+		for _, rel := range strings.Fields(m.Rel) {
+			switch rel {
+			case "original":
+				nm.Original = m
+			case "timegate":
+				nm.TimeGate = m
+			case "timemap":
+				nm.TimeMap = m
+			case "first":
+				nm.First = m
+			case "prev":
+				nm.Prev = m
+			case "next":
+				nm.Next = m
+			case "last":
+				nm.Last = m
+			}
+		}
+	}
+
+	return nm, nil
+}
+
+// TimeGateURL returns the URI-G to use for datetime negotiation of the
+// timemap's original resource.  The Wayback Machine advertises its bare base
+// URL as the TimeGate, in which case the original URL is appended.
+func (timemap *TimeMap) TimeGateURL() string {
+	if timemap.TimeGate == nil || timemap.Original == nil {
+		return ""
+	}
+	uriG := timemap.TimeGate.URL
+	if u, err := url.Parse(uriG); err == nil && (u.Path == "" || u.Path == "/") {
+		uriG = fmt.Sprintf("%v/web/%v", strings.TrimRight(uriG, "/"), timemap.Original.URL)
+	}
+	return uriG
+}
@@ -0,0 +1,74 @@
+package archiveorg
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiateMemento(t *testing.T) {
+	// NB: http.ServeMux would clean the "//" out of these paths.
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/web/https://jaytaylor.com/":
+			serveTimeGate(t, w, r)
+		case "/web/20150527024618/http://jaytaylor.com:80/":
+			serveMemento(w)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	nm, err := c.NegotiateMemento("https://jaytaylor.com/", time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := c.BaseURL+"/web/20150527024618/http://jaytaylor.com:80/", nm.URL; actual != expected {
+		t.Errorf("Expected URL=%v but actual=%v", expected, actual)
+	}
+	if expected := time.Date(2015, 5, 27, 2, 46, 18, 0, time.UTC); nm.Time == nil || !nm.Time.Equal(expected) {
+		t.Errorf("Expected time=%v but actual=%v", expected, nm.Time)
+	}
+	for name, m := range map[string]*Memento{"original": nm.Original, "timemap": nm.TimeMap, "timegate": nm.TimeGate, "first": nm.First, "prev": nm.Prev, "next": nm.Next, "last": nm.Last} {
+		if m == nil {
+			t.Errorf("Expected %v link to be populated", name)
+		}
+	}
+	if nm.Prev != nil && (nm.Prev.Time == nil || nm.Prev.Time.Year() != 2015) {
+		t.Errorf("Unexpected prev memento: %+v", nm.Prev)
+	}
+}
+
+func serveTimeGate(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	if expected, actual := "Mon, 01 Jun 2015 00:00:00 GMT", r.Header.Get("Accept-Datetime"); actual != expected {
+		t.Errorf("Expected Accept-Datetime=%q but actual=%q", expected, actual)
+	}
+	// NB: http.Redirect would also clean the path.
+	w.Header().Set("Location", "/web/20150527024618/http://jaytaylor.com:80/")
+	w.WriteHeader(http.StatusFound)
+}
+
+func serveMemento(w http.ResponseWriter) {
+	w.Header().Set("Memento-Datetime", "Wed, 27 May 2015 02:46:18 GMT")
+	w.Header().Set("Link", strings.Join([]string{
+		`<http://jaytaylor.com:80/>; rel="original"`,
+		`<http://web.archive.org/web/timemap/link/http://jaytaylor.com:80/>; rel="timemap"; type="application/link-format"`,
+		`<http://web.archive.org/web/http://jaytaylor.com:80/>; rel="timegate"`,
+		`<http://web.archive.org/web/20010331114839/http://www.jaytaylor.com:80/>; rel="first memento"; datetime="Sat, 31 Mar 2001 11:48:39 GMT"`,
+		`<http://web.archive.org/web/20150426005920/http://jaytaylor.com:80/>; rel="prev memento"; datetime="Sun, 26 Apr 2015 00:59:20 GMT"`,
+		`<http://web.archive.org/web/20150627021127/http://jaytaylor.com:80/>; rel="next memento"; datetime="Sat, 27 Jun 2015 02:11:27 GMT"`,
+		`<http://web.archive.org/web/20180519054157/https://jaytaylor.com/>; rel="last memento"; datetime="Sat, 19 May 2018 05:41:57 GMT"`,
+	}, ", "))
+}
+
+func TestTimeMapTimeGateURL(t *testing.T) {
+	timemap, err := ParseTimeMap(strings.NewReader(rawTimeMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := "http://web.archive.org/web/http://www.jaytaylor.com:80/", timemap.TimeGateURL(); actual != expected {
+		t.Errorf("Expected TimeGate URL=%v but actual=%v", expected, actual)
+	}
+}
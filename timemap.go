@@ -5,12 +5,12 @@ package archiveorg
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
-	"regexp"
-	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -19,10 +19,7 @@ import (
 var (
 	MementoParseErr = errors.New("malformed input: memento parse failed")
 
-	mementoLayout         = "Mon, 02 Jan 2006 15:04:05 MST"
-	mementoOuterSplitExpr = regexp.MustCompile(`^<(.*)>; (.*),$`) //(?:([^=]+)="([^"]*)"[;,])*$`) // (?: type="([^"]*)"[;,])?(?: from="([^"]*)"[;,])?(?: datetime="([^"]*)"[;,])?$`)
-	mementoTailSplitExpr  = regexp.MustCompile(` *; *`)           // ([^=]+)="([^"]*)"[;,])`)
-	mementoTailParseExpr  = regexp.MustCompile(`([^=]+)="([^"]*)"`)
+	mementoLayout = "Mon, 02 Jan 2006 15:04:05 MST"
 )
 
 /*
@@ -33,18 +30,32 @@ var (
 */
 
 type TimeMap struct {
-	Original *Memento
-	Self     *Memento
-	TimeGate *Memento
+	Original *Memento `json:",omitempty"`
+	Self     *Memento `json:",omitempty"`
+	TimeGate *Memento `json:",omitempty"`
 	Mementos []Memento
+	Pages    []Memento `json:",omitempty"` // Other pages of a paged TimeMap (rel="timemap"), with their from/until boundaries.
+	Prev     *Memento  `json:",omitempty"` // Previous page of a paged TimeMap.
+	Next     *Memento  `json:",omitempty"` // Next page of a paged TimeMap.
+
+	index []*Memento // Mementos with a datetime, sorted chronologically.
 }
 
 type Memento struct {
-	URL  string
-	Rel  string
-	Type *string    `json:,omitempty`
-	From *time.Time `json:,omitempty`
-	Time *time.Time `json:,omitempty`
+	URL   string
+	Rel   string
+	Type  *string    `json:",omitempty"`
+	From  *time.Time `json:",omitempty"`
+	Until *time.Time `json:",omitempty"`
+	Time  *time.Time `json:",omitempty"`
+
+	Params map[string]string `json:",omitempty"` // Any other link-params, e.g. "title" or "license".
+
+	// Only populated by the JSON and CDXJ TimeMap formats.
+	MimeType   string `json:",omitempty"`
+	StatusCode int    `json:",omitempty"`
+	Digest     string `json:",omitempty"`
+	Length     int64  `json:",omitempty"`
 }
 
 func NewTimeMap() *TimeMap {
@@ -54,134 +65,234 @@ func NewTimeMap() *TimeMap {
 	return timemap
 }
 
+// TimeMapFor downloads and parses the TimeMap for url using the package-level
+// default client settings.
 func TimeMapFor(url string, timeout ...time.Duration) (*TimeMap, error) {
-	if len(timeout) == 0 {
-		timeout = []time.Duration{DefaultRequestTimeout}
-	}
+	return defaultClient(timeout...).TimeMap(url)
+}
 
-	resp, err := downloadTimeMap(url, timeout[0])
-	if err != nil {
-		return nil, err
-	}
+// TimeMapForContext is like TimeMapFor but aborts when ctx is done.
+func TimeMapForContext(ctx context.Context, url string, timeout ...time.Duration) (*TimeMap, error) {
+	return defaultClient(timeout...).TimeMapContext(ctx, url)
+}
 
-	defer resp.Body.Close()
+// TimeMap downloads and parses the TimeMap for url.
+func (c *Client) TimeMap(url string) (*TimeMap, error) {
+	return c.TimeMapContext(context.Background(), url)
+}
+
+// TimeMapContext downloads and parses the TimeMap for url, aborting the
+// request when ctx is done.  Paged TimeMaps are followed and merged into a
+// single TimeMap whose Pages field records the page boundaries.
+func (c *Client) TimeMapContext(ctx context.Context, url string) (*TimeMap, error) {
+	var timemap *TimeMap
 
-	timemap, err := ParseTimeMap(resp.Body)
+	err := c.TimeMapPages(ctx, url, func(page *TimeMap) error {
+		if timemap == nil {
+			timemap = page
+			return nil
+		}
+		timemap.Mementos = append(timemap.Mementos, page.Mementos...)
+		for _, p := range page.Pages {
+			if !hasPage(timemap.Pages, p.URL) {
+				timemap.Pages = append(timemap.Pages, p)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	timemap.Prev = nil
+	timemap.Next = nil
+	timemap.Reindex()
+
 	return timemap, nil
 }
 
-// ParseTimeMap takes a reader and parses it as a complete TimeMap.
-func ParseTimeMap(r io.Reader) (*TimeMap, error) {
-	timemap := NewTimeMap()
+// TimeMapPages downloads the TimeMap for url page by page, following
+// rel="timemap" and rel="next" links, and invokes fn with each parsed page.
+// Iteration stops at the first error returned by fn.
+func (c *Client) TimeMapPages(ctx context.Context, url string, fn func(page *TimeMap) error) error {
+	format := c.TimeMapFormat
+	if format == "" {
+		format = TimeMapLinkFormat
+	}
+
+	var (
+		queue   = []string{fmt.Sprintf("%v/web/timemap/%v/%v", c.BaseURL, format, url)}
+		visited = map[string]bool{}
+	)
 
-	scanner := bufio.NewScanner(r)
+	for len(queue) > 0 {
+		pageURL := queue[0]
+		queue = queue[1:]
+		if visited[pageURL] {
+			continue
+		}
+		visited[pageURL] = true
+
+		page, err := c.downloadTimeMapPage(ctx, pageURL, format)
+		if err != nil {
+			return err
+		}
+		if page.Self != nil {
+			visited[page.Self.URL] = true
+		}
 
-	for i := 1; scanner.Scan(); i++ {
-		if line := strings.TrimSpace(scanner.Text()); line != "" {
-			m, err := ParseMemento(line)
-			if err != nil {
-				return nil, fmt.Errorf("%s: on line %v: %v", err, i, line)
+		links := append([]Memento{}, page.Pages...)
+		if page.Next != nil {
+			links = append(links, *page.Next)
+		}
+		for _, link := range links {
+			if next := resolveReference(pageURL, link.URL); !visited[next] {
+				queue = append(queue, next)
 			}
+		}
 
-			switch m.Rel {
-			case "memento", "first memento":
-				timemap.Mementos = append(timemap.Mementos, *m)
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
 
-			case "timegate":
-				timemap.TimeGate = m
+	return nil
+}
 
-			case "self":
-				timemap.Self = m
+func (c *Client) downloadTimeMapPage(ctx context.Context, timeMapURL string, format TimeMapFormat) (*TimeMap, error) {
+	resp, err := c.downloadTimeMap(ctx, timeMapURL)
+	if err != nil {
+		return nil, err
+	}
 
-			case "original":
-				timemap.Original = m
+	defer resp.Body.Close()
 
-			case "default":
-				return nil, fmt.Errorf("no handler for memento rel value %q", m.Rel)
-			}
-		}
+	format = timeMapFormatFor(resp.Header.Get("Content-Type"), format)
+
+	timemap, err := parseTimeMapFormat(resp.Body, format, c.BaseURL)
+	if err != nil {
+		return nil, err
 	}
 
 	return timemap, nil
 }
 
-// ParseMemento parses a line containing a Memento entry.
-func ParseMemento(line string) (*Memento, error) {
-	outerPieces := mementoOuterSplitExpr.FindAllStringSubmatch(line, -1)
+func hasPage(pages []Memento, u string) bool {
+	for _, p := range pages {
+		if p.URL == u {
+			return true
+		}
+	}
+	return false
+}
 
-	if len(outerPieces) == 0 {
-		return nil, MementoParseErr
+// ParseTimeMap takes a reader and parses it as a complete TimeMap.
+func ParseTimeMap(r io.Reader) (*TimeMap, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
 
-	m := &Memento{
-		URL: outerPieces[0][1],
+	links, err := ParseLinkHeader(string(data))
+	if err != nil {
+		return nil, err
 	}
 
-	tailPieces := mementoTailSplitExpr.Split(outerPieces[0][2], -1)
+	timemap := NewTimeMap()
 
-	if len(tailPieces) == 0 {
-		return m, nil
-	}
+	for _, m := range links {
+		switch {
+		case m.HasRel("memento"):
+			timemap.Mementos = append(timemap.Mementos, *m)
 
-	for _, tailPiece := range tailPieces {
-		matches := mementoTailParseExpr.FindAllStringSubmatch(tailPiece, -1)
-		if len(matches) == 0 {
-			log.WithField("line", line).Warnf("Unexpected input, unrecognized tail piece: %v", tailPiece)
-			continue
-		}
+		case m.HasRel("timemap"):
+			timemap.Pages = append(timemap.Pages, *m)
 
-		switch matches[0][1] {
-		case "rel":
-			m.Rel = matches[0][2]
+		case m.HasRel("timegate"):
+			timemap.TimeGate = m
 
-		case "type":
-			typ := matches[0][2]
-			m.Type = &typ
+		case m.HasRel("self"):
+			timemap.Self = m
 
-		case "from":
-			t, err := time.Parse(mementoLayout, matches[0][2])
-			if err != nil {
-				log.Errorf("%s", err)
-				return nil, MementoParseErr
-			}
-			m.From = &t
+		case m.HasRel("original"):
+			timemap.Original = m
 
-		case "datetime":
-			t, err := time.Parse(mementoLayout, matches[0][2])
-			if err != nil {
-				log.Errorf("%s", err)
-				return nil, MementoParseErr
-			}
-			m.Time = &t
+		case m.HasRel("prev"):
+			timemap.Prev = m
+
+		case m.HasRel("next"):
+			timemap.Next = m
 
 		default:
-			log.WithField("line", line).Warnf("Unexpected input, unrecognized memento field: %v", matches[0][1])
+			log.WithField("url", m.URL).Warnf("Unexpected input, unrecognized memento rel value: %v", m.Rel)
 		}
 	}
 
-	return m, nil
-}
+	timemap.Reindex()
 
-func downloadTimeMap(url string, timeout time.Duration) (*http.Response, error) {
-	timeMapURL := fmt.Sprintf("%v/web/timemap/link/%v", BaseURL, url)
+	return timemap, nil
+}
 
-	req, err := newRequest("", timeMapURL, nil)
+// ParseMemento parses a single link-value, optionally followed by a ','.
+func ParseMemento(line string) (*Memento, error) {
+	links, err := ParseLinkHeader(line)
 	if err != nil {
 		return nil, err
 	}
+	if len(links) != 1 {
+		return nil, fmt.Errorf("%s: expected 1 link-value but found %v", MementoParseErr, len(links))
+	}
+	return links[0], nil
+}
+
+func (c *Client) downloadTimeMap(ctx context.Context, timeMapURL string) (*http.Response, error) {
+	var resp *http.Response
+	err := c.retry(ctx, timeMapURL, func() error {
+		req, err := c.newRequest(ctx, "", timeMapURL, nil)
+		if err != nil {
+			return err
+		}
 
-	client := newClient(timeout)
-	resp, err := client.Do(req)
+		if resp, err = c.httpClient().Do(req); err != nil {
+			return fmt.Errorf("executing request to %v: %w", timeMapURL, err)
+		}
+		if resp.StatusCode/100 != 2 {
+			err := newHTTPError(resp)
+			resp.Body.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("executing request to %v: %s", timeMapURL, err)
-	}
-	if resp.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("request to %v received non-2xx response status-code=%v", timeMapURL, resp.StatusCode)
+		return nil, err
 	}
 
 	return resp, nil
 }
+
+// WriteLinkFormat serializes the TimeMap as RFC 7089 application/link-format,
+// suitable for reading back with ParseTimeMap.
+func (timemap *TimeMap) WriteLinkFormat(w io.Writer) error {
+	links := []*Memento{}
+	for _, m := range []*Memento{timemap.Original, timemap.Self, timemap.TimeGate, timemap.Prev, timemap.Next} {
+		if m != nil {
+			links = append(links, m)
+		}
+	}
+	for i := range timemap.Pages {
+		links = append(links, &timemap.Pages[i])
+	}
+	for i := range timemap.Mementos {
+		links = append(links, &timemap.Mementos[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, m := range links {
+		bw.WriteString(m.linkValue())
+		if i < len(links)-1 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
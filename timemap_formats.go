@@ -0,0 +1,151 @@
+package archiveorg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// TimeMapFormat selects the serialization requested from /web/timemap/.
+type TimeMapFormat string
+
+const (
+	TimeMapLinkFormat TimeMapFormat = "link" // RFC 7089 application/link-format (default).
+	TimeMapJSONFormat TimeMapFormat = "json" // CDX-style JSON rows.
+	TimeMapCDXJFormat TimeMapFormat = "cdxj" // CDXJ lines: urlkey timestamp {json}.
+)
+
+// timeMapFormatFor detects the TimeMap format from a Content-Type header value,
+// falling back to the requested format when it is inconclusive.
+func timeMapFormatFor(contentType string, requested TimeMapFormat) TimeMapFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return requested
+	}
+	switch {
+	case mediaType == "application/link-format":
+		return TimeMapLinkFormat
+	case strings.Contains(mediaType, "cdxj"):
+		return TimeMapCDXJFormat
+	case mediaType == "application/json":
+		return TimeMapJSONFormat
+	}
+	return requested
+}
+
+// parseTimeMapFormat parses r according to format.
+func parseTimeMapFormat(r io.Reader, format TimeMapFormat, baseURL string) (*TimeMap, error) {
+	switch format {
+	case TimeMapJSONFormat:
+		return ParseTimeMapJSON(r, baseURL)
+	case TimeMapCDXJFormat:
+		return ParseTimeMapCDXJ(r, baseURL)
+	default:
+		return ParseTimeMap(r)
+	}
+}
+
+// ParseTimeMapJSON parses /web/timemap/json/ output, where the first row names
+// the fields.  Memento URLs are built relative to baseURL.
+func ParseTimeMapJSON(r io.Reader, baseURL string) (*TimeMap, error) {
+	rows := [][]string{}
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%s: %s", MementoParseErr, err)
+	}
+
+	records, _, err := parseCDXRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", MementoParseErr, err)
+	}
+
+	timemap := NewTimeMap()
+	for _, record := range records {
+		timemap.addRecord(record, baseURL)
+	}
+	timemap.Reindex()
+
+	return timemap, nil
+}
+
+// ParseTimeMapCDXJ parses CDXJ output, one "urlkey timestamp {json}" capture
+// per line.  Memento URLs are built relative to baseURL.
+func ParseTimeMapCDXJ(r io.Reader, baseURL string) (*TimeMap, error) {
+	timemap := NewTimeMap()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record, err := parseCDXJLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: on line %v: %s", MementoParseErr, i, err)
+		}
+		timemap.addRecord(record, baseURL)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	timemap.Reindex()
+
+	return timemap, nil
+}
+
+// parseCDXJLine parses a single "urlkey timestamp {json}" CDXJ line.
+func parseCDXJLine(line string) (CDXRecord, error) {
+	record := CDXRecord{}
+
+	pieces := strings.SplitN(line, " ", 3)
+	if len(pieces) != 3 {
+		return record, fmt.Errorf("expected 3 space separated fields but found %v", len(pieces))
+	}
+
+	var fields struct {
+		URL      string `json:"url"`
+		Mime     string `json:"mime"`
+		Status   string `json:"status"`
+		Digest   string `json:"digest"`
+		Length   string `json:"length"`
+		Redirect string `json:"redirect"`
+		Offset   string `json:"offset"`
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal([]byte(pieces[2]), &fields); err != nil {
+		return record, err
+	}
+
+	return newCDXRecord(
+		[]string{"urlkey", "timestamp", "original", "mimetype", "statuscode", "digest", "length", "redirect", "offset", "filename"},
+		[]string{pieces[0], pieces[1], fields.URL, fields.Mime, fields.Status, fields.Digest, fields.Length, fields.Redirect, fields.Offset, fields.Filename},
+	)
+}
+
+// addRecord appends a memento for the CDX record, setting Original from the
+// first record seen.
+func (timemap *TimeMap) addRecord(record CDXRecord, baseURL string) {
+	if timemap.Original == nil {
+		timemap.Original = &Memento{
+			URL: record.Original,
+			Rel: "original",
+		}
+	}
+
+	ts := record.Timestamp
+	m := Memento{
+		URL:        fmt.Sprintf("%v/web/%v/%v", baseURL, ts.Format(timestampLayout), record.Original),
+		Rel:        "memento",
+		Time:       &ts,
+		MimeType:   record.MimeType,
+		StatusCode: record.StatusCode,
+		Digest:     record.Digest,
+		Length:     record.Length,
+	}
+	timemap.Mementos = append(timemap.Mementos, m)
+}
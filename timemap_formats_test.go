@@ -0,0 +1,68 @@
+package archiveorg
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTimeMapCDXJ(t *testing.T) {
+	input := `com,jaytaylor)/ 20010331114839 {"url": "http://www.jaytaylor.com:80/", "mime": "text/html", "status": "200", "digest": "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY", "length": "1204"}
+com,jaytaylor)/ 20010405072207 {"url": "http://www.jaytaylor.com:80/", "mime": "warc/revisit", "status": "-", "digest": "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY", "length": "512"}
+`
+	timemap, err := ParseTimeMapCDXJ(strings.NewReader(input), "https://web.archive.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := 2, len(timemap.Mementos); actual != expected {
+		t.Fatalf("Expected num mementos=%v but actual=%v", expected, actual)
+	}
+	m := timemap.Mementos[0]
+	if expected, actual := "https://web.archive.org/web/20010331114839/http://www.jaytaylor.com:80/", m.URL; actual != expected {
+		t.Errorf("Expected URL=%v but actual=%v", expected, actual)
+	}
+	if m.MimeType != "text/html" || m.StatusCode != 200 || m.Digest != "JTVNUFIH3QMXMQ5ZM6QLGFKNYP4SDRAY" || m.Length != 1204 {
+		t.Errorf("Unexpected memento fields: %+v", m)
+	}
+	if expected, actual := "http://www.jaytaylor.com:80/", timemap.Original.URL; actual != expected {
+		t.Errorf("Expected original=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestTimeMapJSONFormat(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expected, actual := "/web/timemap/json/https://jaytaylor.com/", r.URL.Path; actual != expected {
+			t.Errorf("Expected path=%v but actual=%v", expected, actual)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, rawCDXJSON)
+	}))
+	c.TimeMapFormat = TimeMapJSONFormat
+
+	timemap, err := c.TimeMap("https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := 2, len(timemap.Mementos); actual != expected {
+		t.Fatalf("Expected num mementos=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := int64(3520), timemap.First().Length; actual != expected {
+		t.Errorf("Expected length=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestTimeMapFormatFor(t *testing.T) {
+	testCases := map[string]TimeMapFormat{
+		"application/link-format":         TimeMapLinkFormat,
+		"application/json; charset=utf-8": TimeMapJSONFormat,
+		"text/x-cdxj":                     TimeMapCDXJFormat,
+		"text/plain":                      TimeMapCDXJFormat,
+	}
+	for contentType, expected := range testCases {
+		if actual := timeMapFormatFor(contentType, TimeMapCDXJFormat); actual != expected {
+			t.Errorf("[content-type=%v] Expected format=%v but actual=%v", contentType, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package archiveorg
+
+// Offline temporal navigation of TimeMap mementos.
+
+import (
+	"sort"
+	"time"
+)
+
+// Reindex rebuilds the chronological memento index used by the navigation
+// methods.  ParseTimeMap builds the index automatically; call Reindex after
+// modifying Mementos.
+func (timemap *TimeMap) Reindex() {
+	index := make([]*Memento, 0, len(timemap.Mementos))
+	for i := range timemap.Mementos {
+		if timemap.Mementos[i].Time != nil {
+			index = append(index, &timemap.Mementos[i])
+		}
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return index[i].Time.Before(*index[j].Time)
+	})
+	timemap.index = index
+}
+
+// sorted returns the chronological memento index, building it on first use.
+func (timemap *TimeMap) sorted() []*Memento {
+	if timemap.index == nil {
+		timemap.Reindex()
+	}
+	return timemap.index
+}
+
+// First returns the earliest memento, or nil if there are none.
+func (timemap *TimeMap) First() *Memento {
+	index := timemap.sorted()
+	if len(index) == 0 {
+		return nil
+	}
+	return index[0]
+}
+
+// Last returns the most recent memento, or nil if there are none.
+func (timemap *TimeMap) Last() *Memento {
+	index := timemap.sorted()
+	if len(index) == 0 {
+		return nil
+	}
+	return index[len(index)-1]
+}
+
+// Before returns the most recent memento at or before t, or nil if there is
+// none.
+func (timemap *TimeMap) Before(t time.Time) *Memento {
+	index := timemap.sorted()
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].Time.After(t)
+	})
+	if i == 0 {
+		return nil
+	}
+	return index[i-1]
+}
+
+// After returns the earliest memento at or after t, or nil if there is none.
+func (timemap *TimeMap) After(t time.Time) *Memento {
+	index := timemap.sorted()
+	i := timemap.search(t)
+	if i == len(index) {
+		return nil
+	}
+	return index[i]
+}
+
+// Nearest returns the memento closest to t, preferring the earlier one on a
+// tie, or nil if there are none.
+func (timemap *TimeMap) Nearest(t time.Time) *Memento {
+	var (
+		before = timemap.Before(t)
+		after  = timemap.After(t)
+	)
+	switch {
+	case before == nil:
+		return after
+	case after == nil:
+		return before
+	case after.Time.Sub(t) < t.Sub(*before.Time):
+		return after
+	default:
+		return before
+	}
+}
+
+// Between returns the mementos captured from from through to, inclusive, in
+// chronological order.
+func (timemap *TimeMap) Between(from time.Time, to time.Time) []*Memento {
+	index := timemap.sorted()
+	var (
+		i = timemap.search(from)
+		j = sort.Search(len(index), func(j int) bool {
+			return index[j].Time.After(to)
+		})
+	)
+	if i >= j {
+		return []*Memento{}
+	}
+	between := make([]*Memento, j-i)
+	copy(between, index[i:j])
+	return between
+}
+
+// Histogram returns the number of mementos per month, keyed by year.  Each
+// slice holds 12 counts, January first.
+func (timemap *TimeMap) Histogram() map[int][]int {
+	histogram := map[int][]int{}
+	for _, m := range timemap.sorted() {
+		t := m.Time.UTC()
+		if _, ok := histogram[t.Year()]; !ok {
+			histogram[t.Year()] = make([]int, 12)
+		}
+		histogram[t.Year()][t.Month()-1]++
+	}
+	return histogram
+}
+
+// search returns the index of the first memento at or after t.
+func (timemap *TimeMap) search(t time.Time) int {
+	index := timemap.sorted()
+	return sort.Search(len(index), func(i int) bool {
+		return !index[i].Time.Before(t)
+	})
+}
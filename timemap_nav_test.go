@@ -0,0 +1,66 @@
+package archiveorg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeMapNavigation(t *testing.T) {
+	timemap, err := ParseTimeMap(strings.NewReader(rawTimeMap))
+	if err != nil {
+		t.Fatalf("Error parsing TimeMap fixture: %s", err)
+	}
+
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name     string
+		memento  *Memento
+		expected string
+	}{
+		{"first", timemap.First(), "20010331114839"},
+		{"last", timemap.Last(), "20180519054157"},
+		{"before", timemap.Before(date(2015, 6, 1)), "20150527024618"},
+		{"after", timemap.After(date(2015, 6, 1)), "20150627021127"},
+		{"nearest", timemap.Nearest(date(2015, 6, 1)), "20150527024618"},
+		{"nearest-exact", timemap.Nearest(time.Date(2015, 6, 27, 2, 11, 27, 0, time.UTC)), "20150627021127"},
+	}
+	for _, testCase := range testCases {
+		if testCase.memento == nil {
+			t.Errorf("[%v] Expected a memento but got nil", testCase.name)
+			continue
+		}
+		if actual := testCase.memento.Time.Format(timestampLayout); actual != testCase.expected {
+			t.Errorf("[%v] Expected memento at %v but actual=%v", testCase.name, testCase.expected, actual)
+		}
+	}
+
+	if m := timemap.Before(date(2000, 1, 1)); m != nil {
+		t.Errorf("Expected no memento before 2000 but got %+v", m)
+	}
+	if m := timemap.After(date(2019, 1, 1)); m != nil {
+		t.Errorf("Expected no memento after 2019 but got %+v", m)
+	}
+
+	if expected, actual := 14, len(timemap.Between(date(2015, 1, 1), date(2015, 12, 31))); actual != expected {
+		t.Errorf("Expected num mementos in 2015=%v but actual=%v", expected, actual)
+	}
+
+	histogram := timemap.Histogram()
+	if expected, actual := []int{0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 1, 0}, histogram[2001]; fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("Expected 2001 histogram=%v but actual=%v", expected, actual)
+	}
+	total := 0
+	for _, months := range histogram {
+		for _, count := range months {
+			total += count
+		}
+	}
+	if expected, actual := len(timemap.Mementos), total; actual != expected {
+		t.Errorf("Expected histogram total=%v but actual=%v", expected, actual)
+	}
+}
@@ -4,8 +4,12 @@ package archiveorg
 // timemap, err := TimeMapFor(u)
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -228,3 +232,105 @@ const rawTimeMap = `
 <http://web.archive.org/web/20180329054824/http://jaytaylor.com/>; rel="memento"; datetime="Thu, 29 Mar 2018 05:48:24 GMT",
 <http://web.archive.org/web/20180519054157/https://jaytaylor.com/>; rel="memento"; datetime="Sat, 19 May 2018 05:41:57 GMT",
 `
+
+func TestTimeMapWriteLinkFormat(t *testing.T) {
+	timemap, err := ParseTimeMap(strings.NewReader(rawTimeMap))
+	if err != nil {
+		t.Fatalf("Error parsing TimeMap fixture: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := timemap.WriteLinkFormat(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := strings.TrimSpace(rawTimeMap), strings.TrimSpace(buf.String()); actual != strings.TrimSuffix(expected, ",") {
+		t.Errorf("Expected link-format output to match fixture, got:\n%v", actual)
+	}
+
+	roundTripped, err := ParseTimeMap(&buf)
+	if err != nil {
+		t.Fatalf("Error parsing serialized TimeMap: %s", err)
+	}
+	if !reflect.DeepEqual(timemap.Mementos, roundTripped.Mementos) {
+		t.Errorf("Expected round-tripped mementos to match original")
+	}
+}
+
+func TestTimeMapJSON(t *testing.T) {
+	timemap, err := ParseTimeMap(strings.NewReader(rawTimeMap))
+	if err != nil {
+		t.Fatalf("Error parsing TimeMap fixture: %s", err)
+	}
+
+	data, err := json.Marshal(timemap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"Type":null`) {
+		t.Errorf("Expected nil Type fields to be omitted: %s", data)
+	}
+
+	decoded := &TimeMap{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := len(timemap.Mementos), len(decoded.Mementos); actual != expected {
+		t.Errorf("Expected num mementos=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := timemap.Last().Time, decoded.Last().Time; !actual.Equal(*expected) {
+		t.Errorf("Expected last memento time=%v but actual=%v", expected, actual)
+	}
+}
+
+func TestTimeMapPaged(t *testing.T) {
+	var baseURL string
+
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RequestURI() {
+		case "/web/timemap/link/https://jaytaylor.com/":
+			fmt.Fprintf(w, `<https://jaytaylor.com/>; rel="original",
+<%[1]v/web/timemap/link/https://jaytaylor.com/>; rel="self"; type="application/link-format"; from="Sat, 31 Mar 2001 11:48:39 GMT"; until="Thu, 05 Apr 2001 07:22:07 GMT",
+<%[1]v/web/timemap/link/https://jaytaylor.com/?page=2>; rel="timemap"; type="application/link-format"; from="Wed, 28 Nov 2001 15:39:04 GMT"; until="Fri, 18 Jan 2002 04:08:28 GMT",
+<%[1]v>; rel="timegate",
+<%[1]v/web/20010331114839/https://jaytaylor.com/>; rel="first memento"; datetime="Sat, 31 Mar 2001 11:48:39 GMT",
+<%[1]v/web/20010405072207/https://jaytaylor.com/>; rel="memento"; datetime="Thu, 05 Apr 2001 07:22:07 GMT"
+`, baseURL)
+		case "/web/timemap/link/https://jaytaylor.com/?page=2":
+			fmt.Fprintf(w, `<https://jaytaylor.com/>; rel="original",
+<%[1]v/web/timemap/link/https://jaytaylor.com/?page=2>; rel="self"; type="application/link-format"; from="Wed, 28 Nov 2001 15:39:04 GMT"; until="Fri, 18 Jan 2002 04:08:28 GMT",
+<%[1]v/web/timemap/link/https://jaytaylor.com/?page=3>; rel="next"; type="application/link-format",
+<%[1]v/web/20011128153904/https://jaytaylor.com/>; rel="memento"; datetime="Wed, 28 Nov 2001 15:39:04 GMT",
+<%[1]v/web/20020118040828/https://jaytaylor.com/>; rel="memento"; datetime="Fri, 18 Jan 2002 04:08:28 GMT"
+`, baseURL)
+		case "/web/timemap/link/https://jaytaylor.com/?page=3":
+			fmt.Fprintf(w, `<https://jaytaylor.com/>; rel="original",
+<%[1]v/web/20020328103634/https://jaytaylor.com/>; rel="last memento"; datetime="Thu, 28 Mar 2002 10:36:34 GMT"
+`, baseURL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	baseURL = c.BaseURL
+
+	timemap, err := c.TimeMap("https://jaytaylor.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected, actual := 5, len(timemap.Mementos); actual != expected {
+		t.Errorf("Expected num mementos=%v but actual=%v", expected, actual)
+	}
+	if expected, actual := 1, len(timemap.Pages); actual != expected {
+		t.Fatalf("Expected num pages=%v but actual=%v", expected, actual)
+	}
+	if timemap.Pages[0].From == nil || timemap.Pages[0].Until == nil {
+		t.Errorf("Expected page boundaries to be preserved: %+v", timemap.Pages[0])
+	}
+	if timemap.Self.Until == nil {
+		t.Errorf("Expected self until attribute to be preserved")
+	}
+	if expected, actual := "20020328103634", timemap.Last().Time.Format(timestampLayout); actual != expected {
+		t.Errorf("Expected last memento=%v but actual=%v", expected, actual)
+	}
+}
@@ -0,0 +1,64 @@
+package archiveorg
+
+// Undoing the changes the Wayback Machine makes to replayed HTML and CSS.
+
+import (
+	"regexp"
+)
+
+// Attributes referencing the Wayback Machine's own scripts and stylesheets,
+// which live at the root of its host.  A page's own assets, replayed from
+// e.g. /web/20180326070330cs_/https://docs.example.org/_static/css/, are left
+// alone.
+const (
+	waybackScriptSrc = `\bsrc\s*=\s*["']?(?:(?:https?:)?//[^/"'\s>]*archive\.org/includes/|(?:(?:https?:)?//[^/"'\s>]*archive\.org)?/_static/js/)`
+	waybackStyleHref = `\bhref\s*=\s*["']?(?:(?:https?:)?//[^/"'\s>]*archive\.org)?/_static/css/`
+)
+
+var (
+	// Markup injected into replayed pages.
+	waybackInsertExprs = []*regexp.Regexp{
+		// Toolbar, current and legacy.
+		regexp.MustCompile(`(?is)<!--\s*BEGIN WAYBACK TOOLBAR INSERT\s*-->.*?<!--\s*END WAYBACK TOOLBAR INSERT\s*-->\s*`),
+		// Replay scripts and stylesheets at the top of <head>.
+		regexp.MustCompile(`(?is)<script[^>]*` + waybackScriptSrc + `[^>]*>.*?<!--\s*End Wayback Rewrite JS Include\s*-->\s*`),
+		// Stragglers when the above markers are missing.
+		regexp.MustCompile(`(?is)<script[^>]*` + waybackScriptSrc + `[^>]*>\s*</script>\s*`),
+		regexp.MustCompile(`(?is)<script[^>]*>[^<]*__wm\.[^<]*</script>\s*`),
+		regexp.MustCompile(`(?is)<link[^>]*` + waybackStyleHref + `[^>]*>\s*`),
+		// Trailing archival notes.
+		regexp.MustCompile(`(?is)<!--\s*FILE ARCHIVED ON .*?-->\s*`),
+		regexp.MustCompile(`(?is)<!--\s*playback timings \(ms\):.*?-->\s*`),
+	}
+
+	// Attribute values and CSS url() references which may hold rewritten URLs.
+	urlAttrExpr = regexp.MustCompile(`(?i)\b(?:href|src|srcset|action|poster|background|data)\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+	cssURLExpr  = regexp.MustCompile(`(?i)url\(\s*(?:"[^"]*"|'[^']*'|[^)]*)\s*\)`)
+
+	// e.g. https://web.archive.org/web/20180326070330im_/https://jaytaylor.com/a.png
+	rewrittenURLExpr = regexp.MustCompile(`(?i)(?:(?:https?:)?//[^/\s"'<>()]+)?/web/[0-9]{1,14}(?:[a-z]{2}_)?/((?:https?:)?//[^\s"'<>()]*[^\s"'<>(),])`)
+)
+
+// Unrewrite removes the Wayback Machine toolbar, replay scripts and archival
+// comments from a replayed HTML page, and restores the original absolute URLs
+// in href, src and srcset attributes and CSS url() references.  It also works
+// on replayed stylesheets.
+func Unrewrite(body []byte) []byte {
+	for _, expr := range waybackInsertExprs {
+		body = expr.ReplaceAll(body, nil)
+	}
+	body = urlAttrExpr.ReplaceAllFunc(body, unrewriteURLs)
+	body = cssURLExpr.ReplaceAllFunc(body, unrewriteURLs)
+	return body
+}
+
+// UnrewriteURL returns the original URL of a Wayback Machine replay URL, or u
+// unchanged if it is not one.
+func UnrewriteURL(u string) string {
+	return string(unrewriteURLs([]byte(u)))
+}
+
+// unrewriteURLs replaces each replay URL in s with the original URL.
+func unrewriteURLs(s []byte) []byte {
+	return rewrittenURLExpr.ReplaceAll(s, []byte("$1"))
+}
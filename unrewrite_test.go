@@ -0,0 +1,101 @@
+package archiveorg
+
+import (
+	"strings"
+	"testing"
+)
+
+const rawReplayHTML = `<!DOCTYPE html>
+<html><head><script src="//archive.org/includes/analytics.js?v=cf34f82" type="text/javascript"></script>
+<script type="text/javascript">window.addEventListener('DOMContentLoaded',function(){var v=archive_analytics.values;v.service='wb';});</script>
+<script type="text/javascript" src="/_static/js/bundle-playback.js?v=1B2M2Y8A" charset="utf-8"></script>
+<script type="text/javascript" src="/_static/js/wombat.js?v=1B2M2Y8A" charset="utf-8"></script>
+<script type="text/javascript">
+  __wm.init("https://web.archive.org/web");
+  __wm.wombat("https://jaytaylor.com/","20180326070330","https://web.archive.org/","web","/_static/","1522047810");
+</script>
+<link rel="stylesheet" type="text/css" href="/_static/css/banner-styles.css?v=S1zqJCYt" />
+<link rel="stylesheet" type="text/css" href="/_static/css/iconochive.css?v=qtvMKcIJ" />
+<!-- End Wayback Rewrite JS Include -->
+<title>Jay Taylor</title>
+<link rel="stylesheet" href="/web/20180326070330cs_/https://jaytaylor.com/style.css">
+<style>body { background: url("https://web.archive.org/web/20180326070330im_/https://jaytaylor.com/bg.png"); }</style>
+</head>
+<body><!-- BEGIN WAYBACK TOOLBAR INSERT -->
+<div id="wm-ipp-base" lang="en" style="display:none;direction:ltr;">toolbar</div>
+<!-- END WAYBACK TOOLBAR INSERT -->
+<a href="https://web.archive.org/web/20180326070330/https://jaytaylor.com/about">About</a>
+<a href='//web.archive.org/web/20180326070330/http://example.com/a,b'>Comma</a>
+<img src="/web/20180326070330im_/https://jaytaylor.com/a.png" srcset="/web/20180326070330im_/https://jaytaylor.com/a.png 1x, /web/20180326070330im_/https://jaytaylor.com/a@2x.png 2x">
+<a href="mailto:jay@example.com">Mail</a>
+<p>See /web/20180326070330/https://jaytaylor.com/ in text.</p>
+</body>
+</html>
+<!--
+     FILE ARCHIVED ON 07:03:30 Mar 26, 2018 AND RETRIEVED FROM THE
+     INTERNET ARCHIVE ON 12:00:00 Jan 01, 2019.
+-->
+<!--
+playback timings (ms):
+  captures_list: 120.0
+-->`
+
+func TestUnrewrite(t *testing.T) {
+	actual := string(Unrewrite([]byte(rawReplayHTML)))
+
+	for _, unexpected := range []string{"archive.org/includes", "/_static/", "__wm.", "wm-ipp", "WAYBACK TOOLBAR", "FILE ARCHIVED ON", "playback timings", "web.archive.org/web"} {
+		if strings.Contains(actual, unexpected) {
+			t.Errorf("Expected %q to be removed, but found it in:\n%v", unexpected, actual)
+		}
+	}
+
+	for _, expected := range []string{
+		`<title>Jay Taylor</title>`,
+		`<link rel="stylesheet" href="https://jaytaylor.com/style.css">`,
+		`url("https://jaytaylor.com/bg.png")`,
+		`<a href="https://jaytaylor.com/about">About</a>`,
+		`<a href='http://example.com/a,b'>Comma</a>`,
+		`<img src="https://jaytaylor.com/a.png" srcset="https://jaytaylor.com/a.png 1x, https://jaytaylor.com/a@2x.png 2x">`,
+		`<a href="mailto:jay@example.com">Mail</a>`,
+		// Only attribute values and url() references are rewritten.
+		`<p>See /web/20180326070330/https://jaytaylor.com/ in text.</p>`,
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Expected to find %q in:\n%v", expected, actual)
+		}
+	}
+}
+
+func TestUnrewriteKeepsSiteStatic(t *testing.T) {
+	// Sphinx and ReadTheDocs sites keep their own assets under /_static/.
+	input := `<head>
+<script src="//archive.org/includes/analytics.js?v=cf34f82" type="text/javascript"></script>
+<script type="text/javascript" src="https://web.archive.org/_static/js/wombat.js?v=1B2M2Y8A" charset="utf-8"></script>
+<link rel="stylesheet" type="text/css" href="/_static/css/banner-styles.css?v=S1zqJCYt" />
+<!-- End Wayback Rewrite JS Include -->
+<link rel="stylesheet" href="/web/20180326070330cs_/https://docs.example.org/_static/css/theme.css" type="text/css" />
+<script src="/web/20180326070330js_/https://docs.example.org/_static/js/theme.js"></script>
+</head>`
+
+	expected := `<head>
+<link rel="stylesheet" href="https://docs.example.org/_static/css/theme.css" type="text/css" />
+<script src="https://docs.example.org/_static/js/theme.js"></script>
+</head>`
+	if actual := string(Unrewrite([]byte(input))); actual != expected {
+		t.Errorf("Expected:\n%v\nbut actual:\n%v", expected, actual)
+	}
+}
+
+func TestUnrewriteURL(t *testing.T) {
+	testCases := map[string]string{
+		"https://web.archive.org/web/20180326070330/https://jaytaylor.com/": "https://jaytaylor.com/",
+		"/web/20180326070330js_/https://jaytaylor.com/app.js?v=1":           "https://jaytaylor.com/app.js?v=1",
+		"http://localhost:8080/web/2018id_/http://jaytaylor.com:80/":        "http://jaytaylor.com:80/",
+		"https://jaytaylor.com/web/about":                                   "https://jaytaylor.com/web/about",
+	}
+	for input, expected := range testCases {
+		if actual := UnrewriteURL(input); actual != expected {
+			t.Errorf("[input=%v] Expected %v but actual=%v", input, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package archiveorg
+
+// WARC/1.1 writer as specified at
+// https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	warcVersion    = "WARC/1.1"
+	warcDateLayout = "2006-01-02T15:04:05Z"
+)
+
+// WARC record types.
+const (
+	WARCInfo     = "warcinfo"
+	WARCResponse = "response"
+	WARCResource = "resource"
+	WARCRequest  = "request"
+	WARCMetadata = "metadata"
+	WARCRevisit  = "revisit"
+)
+
+// WARCField is a single named WARC header field.
+type WARCField struct {
+	Name  string
+	Value string
+}
+
+// WARCRecord is a single WARC record.  RecordID and Content-Length are filled
+// in by WARCWriter.WriteRecord when left empty.
+type WARCRecord struct {
+	Type        string
+	RecordID    string // e.g. "<urn:uuid:...>".
+	Date        time.Time
+	TargetURI   string
+	ContentType string
+	Fields      []WARCField // Any other header fields, e.g. WARC-Payload-Digest.
+	Block       []byte
+}
+
+// Field returns the value of the named header field, or "" if absent.
+func (rec *WARCRecord) Field(name string) string {
+	for _, f := range rec.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// WARCWriter writes WARC records to an underlying writer and is safe for
+// concurrent use.
+type WARCWriter struct {
+	Gzip bool // Compress each record as a separate gzip member, as expected for .warc.gz files.
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWARCWriter returns a WARCWriter writing to w.
+func NewWARCWriter(w io.Writer, gzip bool) *WARCWriter {
+	ww := &WARCWriter{
+		Gzip: gzip,
+		w:    w,
+	}
+	return ww
+}
+
+// WriteRecord serializes rec, assigning a RecordID when it has none.
+func (ww *WARCWriter) WriteRecord(rec *WARCRecord) error {
+	if rec.RecordID == "" {
+		id, err := newWARCRecordID()
+		if err != nil {
+			return err
+		}
+		rec.RecordID = id
+	}
+	if rec.Date.IsZero() {
+		rec.Date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(warcVersion + "\r\n")
+	writeWARCField(&buf, "WARC-Type", rec.Type)
+	writeWARCField(&buf, "WARC-Record-ID", rec.RecordID)
+	writeWARCField(&buf, "WARC-Date", rec.Date.UTC().Format(warcDateLayout))
+	if rec.TargetURI != "" {
+		writeWARCField(&buf, "WARC-Target-URI", rec.TargetURI)
+	}
+	if rec.ContentType != "" {
+		writeWARCField(&buf, "Content-Type", rec.ContentType)
+	}
+	for _, f := range rec.Fields {
+		writeWARCField(&buf, f.Name, f.Value)
+	}
+	writeWARCField(&buf, "Content-Length", strconv.Itoa(len(rec.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(rec.Block)
+	buf.WriteString("\r\n\r\n")
+
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	if !ww.Gzip {
+		_, err := ww.w.Write(buf.Bytes())
+		return err
+	}
+	gz := gzip.NewWriter(ww.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WriteWarcinfo writes a warcinfo record describing the file, conventionally
+// the first record.
+func (ww *WARCWriter) WriteWarcinfo(filename string, fields ...WARCField) error {
+	var block bytes.Buffer
+	for _, f := range append([]WARCField{{"software", "jaytaylor.com/archive.org"}, {"format", "WARC File Format 1.1"}}, fields...) {
+		writeWARCField(&block, f.Name, f.Value)
+	}
+	rec := &WARCRecord{
+		Type:        WARCInfo,
+		ContentType: "application/warc-fields",
+		Block:       block.Bytes(),
+	}
+	if filename != "" {
+		rec.Fields = append(rec.Fields, WARCField{"WARC-Filename", filename})
+	}
+	return ww.WriteRecord(rec)
+}
+
+// ExportWARC fetches the original (id_) content and headers of each snapshot
+// and writes it as a response record, dated with the snapshot timestamp,
+// followed by a metadata record pointing back to the Wayback Machine.
+func (c *Client) ExportWARC(ctx context.Context, ww *WARCWriter, snaps ...Snapshot) error {
+	for _, snap := range snaps {
+		if err := c.exportWARC(ctx, ww, snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportWARCRecords is like ExportWARC for captures found via the CDX index.
+func (c *Client) ExportWARCRecords(ctx context.Context, ww *WARCWriter, records ...CDXRecord) error {
+	for _, record := range records {
+		if err := c.exportWARC(ctx, ww, c.cdxSnapshot(record)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) exportWARC(ctx context.Context, ww *WARCWriter, snap Snapshot) error {
+	original := UnrewriteURL(snap.URL)
+
+	content, err := c.FetchSnapshotContext(ctx, original, snap.Timestamp, ModifierIdentity)
+	if err != nil {
+		return fmt.Errorf("fetching %v: %s", snap.URL, err)
+	}
+
+	date := snap.Timestamp
+	if date.IsZero() {
+		date = content.Timestamp
+	}
+
+	response := &WARCRecord{
+		Type:        WARCResponse,
+		Date:        date,
+		TargetURI:   original,
+		ContentType: "application/http;msgtype=response",
+		Block:       httpResponseBlock(content),
+		Fields: []WARCField{
+			{"WARC-Payload-Digest", warcDigest(content.Body)},
+		},
+	}
+	response.Fields = append(response.Fields, WARCField{"WARC-Block-Digest", warcDigest(response.Block)})
+	if err := ww.WriteRecord(response); err != nil {
+		return err
+	}
+
+	var block bytes.Buffer
+	writeWARCField(&block, "via", content.URL)
+	writeWARCField(&block, "retrieved-date", time.Now().UTC().Format(warcDateLayout))
+	metadata := &WARCRecord{
+		Type:        WARCMetadata,
+		Date:        date,
+		TargetURI:   original,
+		ContentType: "application/warc-fields",
+		Block:       block.Bytes(),
+		Fields: []WARCField{
+			{"WARC-Concurrent-To", response.RecordID},
+		},
+	}
+	return ww.WriteRecord(metadata)
+}
+
+// httpResponseBlock reconstructs the archived HTTP response.  The body has
+// already been decoded by the HTTP client, so Content-Encoding and
+// Transfer-Encoding are dropped and Content-Length is corrected.
+func httpResponseBlock(content *SnapshotContent) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "HTTP/1.1 %v %v\r\n", content.StatusCode, http.StatusText(content.StatusCode))
+
+	names := make([]string, 0, len(content.Header))
+	for name := range content.Header {
+		switch name {
+		case "Content-Encoding", "Transfer-Encoding", "Content-Length":
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range content.Header[name] {
+			fmt.Fprintf(&buf, "%v: %v\r\n", name, v)
+		}
+	}
+	fmt.Fprintf(&buf, "Content-Length: %v\r\n\r\n", len(content.Body))
+	buf.Write(content.Body)
+	return buf.Bytes()
+}
+
+// warcDigest returns the base32 encoded SHA-1 digest of data, as used by
+// WARC-Payload-Digest and WARC-Block-Digest.
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newWARCRecordID returns a random (version 4) UUID URN.
+func newWARCRecordID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("generating record ID: %s", err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+func writeWARCField(w io.Writer, name string, value string) {
+	fmt.Fprintf(w, "%v: %v\r\n", name, value)
+}
@@ -0,0 +1,306 @@
+package archiveorg
+
+// Reader for WARC (https://iipc.github.io/warc-specifications/) and ARC
+// (https://archive.org/web/researcher/ArcFileFormat.php) files.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWARCParse is returned by WARCReader for malformed WARC and ARC records,
+// test for it with errors.Is.
+var ErrWARCParse = errors.New("malformed input: WARC parse failed")
+
+// MaxWARCRecordLength is the largest record block WARCReader accepts.  Longer
+// Content-Length or ARC record lengths are rejected with ErrWARCParse.
+var MaxWARCRecordLength int64 = 1 << 30
+
+// WARCReader reads records from a WARC or ARC file, either uncompressed or
+// compressed with one gzip member per record.  Whole-file compression is also
+// readable, but then Offset and Length refer to the single gzip member.
+type WARCReader struct {
+	cr      *countingReader
+	gzipped bool
+	zr      *gzip.Reader
+	member  *bufio.Reader // Decompressed current gzip member.
+
+	offset int64
+	length int64
+}
+
+// NewWARCReader returns a reader for the records in r, detecting gzip
+// compression automatically.
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+
+	magic, err := cr.r.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	wr := &WARCReader{
+		cr:      cr,
+		gzipped: len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b,
+	}
+	return wr, nil
+}
+
+// Next returns the next record, or io.EOF once there are no more.  ARC records
+// are returned as WARC records: the file header as a warcinfo record and HTTP
+// captures as response records.
+func (wr *WARCReader) Next() (*WARCRecord, error) {
+	var rd byteReader = wr.cr
+
+	if wr.gzipped {
+		if wr.member == nil {
+			if _, err := wr.cr.r.Peek(1); err != nil {
+				return nil, err
+			}
+			wr.offset = wr.cr.n
+			if wr.zr == nil {
+				zr, err := gzip.NewReader(wr.cr)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", ErrWARCParse, err)
+				}
+				wr.zr = zr
+			} else if err := wr.zr.Reset(wr.cr); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrWARCParse, err)
+			}
+			wr.zr.Multistream(false)
+			wr.member = bufio.NewReader(wr.zr)
+		}
+		rd = wr.member
+	} else {
+		if err := skipNewlines(rd); err != nil {
+			return nil, err
+		}
+		wr.offset = wr.cr.n
+	}
+
+	rec, err := readWARCRecord(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := skipNewlines(rd); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if wr.gzipped {
+		if _, err := wr.member.Peek(1); err == io.EOF {
+			// Member exhausted, which also consumed the gzip trailer.
+			wr.member = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrWARCParse, err)
+		}
+	}
+	wr.length = wr.cr.n - wr.offset
+
+	return rec, nil
+}
+
+// Offset returns the position in the file of the record last returned by
+// Next.
+func (wr *WARCReader) Offset() int64 {
+	return wr.offset
+}
+
+// Length returns the (compressed) size in the file of the record last
+// returned by Next.
+func (wr *WARCReader) Length() int64 {
+	return wr.length
+}
+
+// readWARCRecord reads a single WARC or ARC record.
+func readWARCRecord(rd byteReader) (*WARCRecord, error) {
+	if err := skipNewlines(rd); err != nil {
+		return nil, err
+	}
+
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWARCParse, err)
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return readARCRecord(rd, line)
+	}
+
+	var (
+		rec    = &WARCRecord{}
+		length = int64(-1)
+	)
+	for {
+		line, err := readLine(rd)
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading header: %s", ErrWARCParse, err)
+		}
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(rec.Fields) > 0 {
+			rec.Fields[len(rec.Fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		pieces := strings.SplitN(line, ":", 2)
+		if len(pieces) != 2 {
+			return nil, fmt.Errorf("%w: invalid header line %q", ErrWARCParse, line)
+		}
+		name, value := strings.TrimSpace(pieces[0]), strings.TrimSpace(pieces[1])
+		switch strings.ToLower(name) {
+		case "warc-type":
+			rec.Type = value
+		case "warc-record-id":
+			rec.RecordID = value
+		case "warc-date":
+			if rec.Date, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, fmt.Errorf("%w: invalid WARC-Date %q", ErrWARCParse, value)
+			}
+		case "warc-target-uri":
+			rec.TargetURI = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "content-type":
+			rec.ContentType = value
+		case "content-length":
+			if length, err = strconv.ParseInt(value, 10, 64); err != nil || length < 0 {
+				return nil, fmt.Errorf("%w: invalid Content-Length %q", ErrWARCParse, value)
+			}
+		default:
+			rec.Fields = append(rec.Fields, WARCField{name, value})
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("%w: missing Content-Length", ErrWARCParse)
+	}
+
+	if rec.Block, err = readBlock(rd, length); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// readBlock reads a record block of length bytes.  The buffer grows as data
+// arrives rather than trusting length up front, so a truncated file claiming
+// a huge record fails without allocating it.
+func readBlock(rd io.Reader, length int64) ([]byte, error) {
+	if length > MaxWARCRecordLength {
+		return nil, fmt.Errorf("%w: record length %v exceeds limit of %v", ErrWARCParse, length, MaxWARCRecordLength)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, rd, length); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: reading block: %s", ErrWARCParse, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readARCRecord reads the remainder of an ARC record given its header line:
+//
+//	URL IP-address Archive-date Content-type [...] Archive-length
+func readARCRecord(rd byteReader, line string) (*WARCRecord, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("%w: unrecognized record header %q", ErrWARCParse, line)
+	}
+	length, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("%w: invalid ARC record length in %q", ErrWARCParse, line)
+	}
+	date, err := ParseTimestamp(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrWARCParse, err)
+	}
+
+	rec := &WARCRecord{
+		Date:      date,
+		TargetURI: fields[0],
+	}
+	if rec.Block, err = readBlock(rd, length); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(rec.TargetURI, "filedesc:"):
+		rec.Type = WARCInfo
+		rec.ContentType = fields[3]
+	case bytes.HasPrefix(rec.Block, []byte("HTTP/")):
+		rec.Type = WARCResponse
+		rec.ContentType = "application/http;msgtype=response"
+	default:
+		rec.Type = WARCResource
+		rec.ContentType = fields[3]
+	}
+	return rec, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteScanner
+}
+
+// readLine reads a line, stripping the trailing CRLF or LF.
+func readLine(rd byteReader) (string, error) {
+	var buf bytes.Buffer
+	for {
+		b, err := rd.ReadByte()
+		if err != nil {
+			if err == io.EOF && buf.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(buf.String(), "\r"), nil
+		}
+		buf.WriteByte(b)
+	}
+}
+
+// skipNewlines consumes CR and LF bytes up to the next record.
+func skipNewlines(rd byteReader) error {
+	for {
+		b, err := rd.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != '\r' && b != '\n' {
+			return rd.UnreadByte()
+		}
+	}
+}
+
+// countingReader tracks the number of bytes consumed from r.  It implements
+// io.ByteReader so gzip.Reader does not read ahead past a member.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+func (cr *countingReader) UnreadByte() error {
+	err := cr.r.UnreadByte()
+	if err == nil {
+		cr.n--
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package archiveorg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWARCReader(t *testing.T) {
+	for _, gzipped := range []bool{false, true} {
+		var (
+			buf bytes.Buffer
+			ww  = NewWARCWriter(&buf, gzipped)
+		)
+		if err := ww.WriteWarcinfo("test.warc"); err != nil {
+			t.Fatal(err)
+		}
+		response := &WARCRecord{
+			Type:        WARCResponse,
+			Date:        time.Date(2018, 3, 26, 7, 3, 30, 0, time.UTC),
+			TargetURI:   "https://jaytaylor.com/",
+			ContentType: "application/http;msgtype=response",
+			Fields:      []WARCField{{"WARC-Payload-Digest", "sha1:ABC"}},
+			Block:       []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"),
+		}
+		if err := ww.WriteRecord(response); err != nil {
+			t.Fatal(err)
+		}
+
+		wr, err := NewWARCReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			records []*WARCRecord
+			offsets []int64
+			total   int64
+		)
+		for {
+			rec, err := wr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("[gzip=%v] %s", gzipped, err)
+			}
+			records = append(records, rec)
+			offsets = append(offsets, wr.Offset())
+			total += wr.Length()
+		}
+
+		if expected, actual := 2, len(records); actual != expected {
+			t.Fatalf("[gzip=%v] Expected %v records but actual=%v", gzipped, expected, actual)
+		}
+		if expected, actual := int64(buf.Len()), total; actual != expected {
+			t.Errorf("[gzip=%v] Expected record lengths to sum to %v but actual=%v", gzipped, expected, actual)
+		}
+		if records[0].Type != WARCInfo || records[0].Field("WARC-Filename") != "test.warc" {
+			t.Errorf("[gzip=%v] Unexpected warcinfo record: %+v", gzipped, records[0])
+		}
+
+		rec := records[1]
+		if rec.Type != response.Type || rec.RecordID != response.RecordID || !rec.Date.Equal(response.Date) || rec.TargetURI != response.TargetURI || rec.ContentType != response.ContentType || rec.Field("WARC-Payload-Digest") != "sha1:ABC" || !bytes.Equal(rec.Block, response.Block) {
+			t.Errorf("[gzip=%v] Expected %+v but actual=%+v", gzipped, response, rec)
+		}
+
+		// Records can be read directly from their offset.
+		wr, err = NewWARCReader(bytes.NewReader(buf.Bytes()[offsets[1]:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec, err := wr.Next(); err != nil || rec.RecordID != response.RecordID {
+			t.Errorf("[gzip=%v] Expected to read record at offset %v, err=%v", gzipped, offsets[1], err)
+		}
+	}
+}
+
+func TestWARCReaderARC(t *testing.T) {
+	var (
+		filedesc = "1 0 Test\nURL IP-address Archive-date Content-type Archive-length\n"
+		response = "HTTP/1.0 200 OK\nContent-Type: text/plain\n\nhi"
+		arc      = "filedesc://test.arc 0.0.0.0 20180326070330 text/plain " + strconv.Itoa(len(filedesc)) + "\n" + filedesc + "\n" +
+			"http://jaytaylor.com/ 1.2.3.4 20180326070331 text/plain " + strconv.Itoa(len(response)) + "\n" + response + "\n"
+	)
+
+	wr, err := NewWARCReader(strings.NewReader(arc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := wr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != WARCInfo || string(info.Block) != filedesc {
+		t.Errorf("Unexpected filedesc record: %+v", info)
+	}
+	rec, err := wr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Type != WARCResponse || rec.TargetURI != "http://jaytaylor.com/" || string(rec.Block) != response || !rec.Date.Equal(time.Date(2018, 3, 26, 7, 3, 31, 0, time.UTC)) {
+		t.Errorf("Unexpected response record: %+v", rec)
+	}
+	if _, err := wr.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF but actual=%v", err)
+	}
+}
+
+func TestWARCReaderMalformed(t *testing.T) {
+	const header = "WARC/1.1\r\nWARC-Type: resource\r\nWARC-Target-URI: https://jaytaylor.com/\r\n"
+	testCases := map[string]string{
+		"missing Content-Length":     header + "\r\n",
+		"negative Content-Length":    header + "Content-Length: -5\r\n\r\nhello",
+		"oversized Content-Length":   header + "Content-Length: 1099511627776\r\n\r\nhello",
+		"overflowing Content-Length": header + "Content-Length: 99999999999999999999\r\n\r\nhello",
+		"truncated block":            header + "Content-Length: 1000\r\n\r\nhello",
+		"oversized ARC record":       "http://jaytaylor.com/ 127.0.0.1 20180101000000 text/html 1099511627776\nhello",
+		"negative ARC record":        "http://jaytaylor.com/ 127.0.0.1 20180101000000 text/html -5\nhello",
+	}
+	for name, input := range testCases {
+		wr, err := NewWARCReader(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wr.Next(); !errors.Is(err, ErrWARCParse) {
+			t.Errorf("[%v] Expected ErrWARCParse but actual=%v", name, err)
+		}
+	}
+}
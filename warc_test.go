@@ -0,0 +1,101 @@
+package archiveorg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportWARC(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/web/20180326070330id_/https://jaytaylor.com/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Memento-Datetime", "Mon, 26 Mar 2018 07:03:30 GMT")
+		w.Header().Set("X-Archive-Orig-Content-Type", "text/html")
+		w.Header().Set("X-Archive-Orig-Content-Length", "999")
+		w.Header().Set("X-Archive-Orig-Transfer-Encoding", "chunked")
+		fmt.Fprint(w, "<html>original</html>")
+	}))
+
+	var (
+		buf  bytes.Buffer
+		ww   = NewWARCWriter(&buf, true)
+		snap = Snapshot{
+			URL:       c.BaseURL + "/web/20180326070330/https://jaytaylor.com/",
+			Timestamp: time.Date(2018, 3, 26, 7, 3, 30, 0, time.UTC),
+		}
+	)
+	if err := c.ExportWARC(context.Background(), ww, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each record is a separate gzip member.
+	var records []string
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		zr.Multistream(false)
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(data))
+		if err := zr.Reset(&buf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected, actual := 2, len(records); actual != expected {
+		t.Fatalf("Expected %v gzip members but actual=%v", expected, actual)
+	}
+
+	response := records[0]
+	payload := "<html>original</html>"
+	for _, s := range []string{
+		"WARC/1.1\r\nWARC-Type: response\r\n",
+		"WARC-Date: 2018-03-26T07:03:30Z\r\n",
+		"WARC-Target-URI: https://jaytaylor.com/\r\n",
+		"Content-Type: application/http;msgtype=response\r\n",
+		"WARC-Payload-Digest: " + warcDigest([]byte(payload)) + "\r\n",
+		"\r\n\r\nHTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 21\r\n\r\n" + payload + "\r\n\r\n",
+	} {
+		if !strings.Contains(response, s) {
+			t.Errorf("Expected response record to contain %q:\n%v", s, response)
+		}
+	}
+	if strings.Contains(response, "chunked") || strings.Contains(response, "999") {
+		t.Errorf("Expected stale framing headers to be dropped:\n%v", response)
+	}
+
+	metadata := records[1]
+	id := response[strings.Index(response, "WARC-Record-ID: ")+len("WARC-Record-ID: "):]
+	id = id[:strings.Index(id, "\r\n")]
+	for _, s := range []string{
+		"WARC-Type: metadata\r\n",
+		"WARC-Concurrent-To: " + id + "\r\n",
+		"via: " + c.BaseURL + "/web/20180326070330id_/https://jaytaylor.com/\r\n",
+	} {
+		if !strings.Contains(metadata, s) {
+			t.Errorf("Expected metadata record to contain %q:\n%v", s, metadata)
+		}
+	}
+}
+
+func TestWARCDigest(t *testing.T) {
+	// Digest of the empty string, as found in real-world WARCs.
+	if expected, actual := "sha1:3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ", warcDigest(nil); actual != expected {
+		t.Errorf("Expected %v but actual=%v", expected, actual)
+	}
+}